@@ -1,8 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config 应用配置
@@ -19,6 +22,28 @@ type Config struct {
 
 	// 数据库路径
 	DatabasePath string
+
+	// 存储后端配置
+	StorageBackend       string // r2、local 或 memory
+	LocalStoragePath     string // 本地存储数据目录
+	StorageSigningSecret string // 自托管后端签名 URL 的 HMAC 密钥，为空时自动生成
+
+	// 分片上传布局：分片大小随文件大小自适应，限制在 [Min, Max] 内，分片数尽量不超过 TargetParts
+	MultipartMinPartSize int64
+	MultipartMaxPartSize int64
+	MultipartTargetParts int
+
+	// 文件过期时间策略：允许的最短/最长时长、默认值和前端展示的预设选项
+	// ExpiryPresetsOnly 为 true 时只允许选择预设值；ExpiryAllowNever 为 true 时允许上传永不过期的文件
+	ExpiryMin         time.Duration
+	ExpiryMax         time.Duration
+	ExpiryDefault     time.Duration
+	ExpiryPresets     []time.Duration
+	ExpiryPresetsOnly bool
+	ExpiryAllowNever  bool
+
+	// 未完成上传的最长保留时间，超过后由清理任务终止分片上传并删除记录
+	StaleUploadAge time.Duration
 }
 
 // Load 从环境变量加载配置
@@ -29,7 +54,52 @@ func Load() *Config {
 		MaxFileSize:  getEnvInt64("MAX_FILE_SIZE", 5*1024*1024*1024), // 默认 5GB
 		TotalStorage: getEnvInt64("TOTAL_STORAGE", 10*1024*1024*1024), // 默认 10GB
 		DatabasePath: getEnv("DATABASE_PATH", "./data/r2box.db"),
+
+		StorageBackend:       getEnv("STORAGE_BACKEND", "r2"),
+		LocalStoragePath:     getEnv("LOCAL_STORAGE_PATH", "./data/objects"),
+		StorageSigningSecret: getEnv("STORAGE_SIGNING_SECRET", ""),
+
+		MultipartMinPartSize: getEnvInt64("MULTIPART_MIN_PART_SIZE", 20*1024*1024),     // 默认 20MB
+		MultipartMaxPartSize: getEnvInt64("MULTIPART_MAX_PART_SIZE", 5*1024*1024*1024), // 默认 5GB
+		MultipartTargetParts: int(getEnvInt64("MULTIPART_TARGET_PARTS", 1000)),
+
+		ExpiryMin:         getEnvDuration("EXPIRY_MIN", time.Minute),
+		ExpiryMax:         getEnvDuration("EXPIRY_MAX", 30*24*time.Hour),
+		ExpiryDefault:     getEnvDuration("EXPIRY_DEFAULT", 7*24*time.Hour),
+		ExpiryPresets:     getEnvDurations("EXPIRY_PRESETS", []time.Duration{24 * time.Hour, 3 * 24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}),
+		ExpiryPresetsOnly: getEnv("EXPIRY_PRESETS_ONLY", "false") == "true",
+		ExpiryAllowNever:  getEnv("EXPIRY_ALLOW_NEVER", "true") == "true",
+
+		StaleUploadAge: getEnvDuration("STALE_UPLOAD_AGE", 24*time.Hour),
+	}
+}
+
+// Validate 检查过期时间策略是否自洽：默认值必须是上传时会被接受的取值，否则不指定有效期的上传都会被拒绝
+func (c *Config) Validate() error {
+	if c.ExpiryMin > c.ExpiryMax {
+		return fmt.Errorf("EXPIRY_MIN (%s) 不能大于 EXPIRY_MAX (%s)", FormatDuration(c.ExpiryMin), FormatDuration(c.ExpiryMax))
+	}
+
+	if c.ExpiryPresetsOnly {
+		for _, preset := range c.ExpiryPresets {
+			if preset == c.ExpiryDefault {
+				return nil
+			}
+		}
+		return fmt.Errorf("EXPIRY_PRESETS_ONLY 已开启，EXPIRY_DEFAULT (%s) 必须是 EXPIRY_PRESETS 中的一项", FormatDuration(c.ExpiryDefault))
+	}
+
+	if c.ExpiryDefault < c.ExpiryMin || c.ExpiryDefault > c.ExpiryMax {
+		return fmt.Errorf("EXPIRY_DEFAULT (%s) 必须在 EXPIRY_MIN (%s) 到 EXPIRY_MAX (%s) 之间",
+			FormatDuration(c.ExpiryDefault), FormatDuration(c.ExpiryMin), FormatDuration(c.ExpiryMax))
+	}
+	for _, preset := range c.ExpiryPresets {
+		if preset < c.ExpiryMin || preset > c.ExpiryMax {
+			return fmt.Errorf("EXPIRY_PRESETS 中的 %s 不在 EXPIRY_MIN (%s) 到 EXPIRY_MAX (%s) 之间",
+				FormatDuration(preset), FormatDuration(c.ExpiryMin), FormatDuration(c.ExpiryMax))
+		}
 	}
+	return nil
 }
 
 // getEnv 获取环境变量，如果不存在则返回默认值
@@ -49,3 +119,31 @@ func getEnvInt64(key string, defaultValue int64) int64 {
 	}
 	return defaultValue
 }
+
+// getEnvDuration 获取时间间隔类型的环境变量（如 "24h"、"90m"、"14d"）
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// getEnvDurations 获取逗号分隔的时间间隔列表（如 "1d,3d,7d,30d"），任一项无效时使用默认值
+func getEnvDurations(key string, defaultValue []time.Duration) []time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var result []time.Duration
+	for _, item := range strings.Split(value, ",") {
+		d, err := ParseDuration(item)
+		if err != nil || d <= 0 {
+			return defaultValue
+		}
+		result = append(result, d)
+	}
+	return result
+}
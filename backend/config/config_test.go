@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	const day = 24 * time.Hour
+	presets := []time.Duration{day, 3 * day, 7 * day, 30 * day}
+
+	tests := []struct {
+		name        string
+		min, max    time.Duration
+		def         time.Duration
+		presets     []time.Duration
+		presetsOnly bool
+		wantErr     bool
+	}{
+		{name: "默认配置", min: time.Minute, max: 30 * day, def: 7 * day, presets: presets},
+		{name: "默认值等于上下限", min: 7 * day, max: 7 * day, def: 7 * day, presets: []time.Duration{7 * day}},
+		{name: "默认值低于最短时长", min: 14 * day, max: 30 * day, def: 7 * day, presets: []time.Duration{14 * day}, wantErr: true},
+		{name: "默认值超过最长时长", min: time.Minute, max: 3 * day, def: 7 * day, presets: []time.Duration{day}, wantErr: true},
+		{name: "最短时长大于最长时长", min: 30 * day, max: day, def: 7 * day, wantErr: true},
+		{name: "预设超出范围", min: time.Minute, max: 7 * day, def: 7 * day, presets: presets, wantErr: true},
+		{name: "仅预设: 默认值在预设中", min: time.Minute, max: 30 * day, def: 3 * day, presets: presets, presetsOnly: true},
+		{name: "仅预设: 默认值不在预设中", min: time.Minute, max: 30 * day, def: 2 * day, presets: presets, presetsOnly: true, wantErr: true},
+		{name: "仅预设: 不检查时长范围", min: time.Minute, max: 3 * day, def: 7 * day, presets: presets, presetsOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				ExpiryMin:         tt.min,
+				ExpiryMax:         tt.max,
+				ExpiryDefault:     tt.def,
+				ExpiryPresets:     tt.presets,
+				ExpiryPresetsOnly: tt.presetsOnly,
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration 解析时间间隔，在 time.ParseDuration 的基础上支持天（d）和周（w），如 "90m"、"12h"、"14d"、"1d12h"
+func ParseDuration(value string) (time.Duration, error) {
+	s := strings.TrimSpace(value)
+	if s == "" {
+		return 0, fmt.Errorf("时间间隔为空")
+	}
+
+	var total time.Duration
+	for _, unit := range []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"w", 7 * 24 * time.Hour},
+		{"d", 24 * time.Hour},
+	} {
+		idx := strings.Index(s, unit.suffix)
+		if idx < 0 {
+			continue
+		}
+		n, err := strconv.ParseFloat(s[:idx], 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("无效的时间间隔: %s", value)
+		}
+		total += time.Duration(n * float64(unit.size))
+		s = s[idx+1:]
+	}
+
+	if s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("无效的时间间隔: %s", value)
+		}
+		total += d
+	}
+	return total, nil
+}
+
+// FormatDuration 将时间间隔格式化为 ParseDuration 可解析的最简形式，如 "14d"、"1d12h"、"90m" 写作 "1h30m"
+func FormatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "0s"
+	}
+
+	var b strings.Builder
+	for _, unit := range []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	} {
+		if n := d / unit.size; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, unit.suffix)
+			d -= n * unit.size
+		}
+	}
+	if b.Len() == 0 {
+		return d.String()
+	}
+	return b.String()
+}
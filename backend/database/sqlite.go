@@ -87,6 +87,69 @@ func createTables() error {
 	DB.Exec("ALTER TABLE files ADD COLUMN short_code TEXT")
 	DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_files_short_code ON files(short_code)")
 
+	// 迁移：记录上传校验失败或修正的原因
+	DB.Exec("ALTER TABLE files ADD COLUMN status_reason TEXT")
+
+	// 迁移：保存分片上传状态，支持跨会话断点续传
+	DB.Exec("ALTER TABLE files ADD COLUMN upload_id TEXT")
+	DB.Exec("ALTER TABLE files ADD COLUMN part_size INTEGER")
+	DB.Exec("ALTER TABLE files ADD COLUMN total_parts INTEGER")
+
+	// 迁移：下载次数限制（0 表示不限制）
+	DB.Exec("ALTER TABLE files ADD COLUMN max_downloads INTEGER DEFAULT 0")
+	DB.Exec("ALTER TABLE files ADD COLUMN download_count INTEGER DEFAULT 0")
+
+	// 迁移：固定的文件永不过期，清理任务会跳过
+	DB.Exec("ALTER TABLE files ADD COLUMN pinned INTEGER DEFAULT 0")
+
+	// 迁移：分享密码（bcrypt 哈希，为空表示无需密码）
+	DB.Exec("ALTER TABLE files ADD COLUMN password_hash TEXT")
+
+	// 迁移：记录类型（file 为上传的文件，paste 为粘贴的文本）及文本的语言
+	DB.Exec("ALTER TABLE files ADD COLUMN kind TEXT DEFAULT 'file'")
+	DB.Exec("ALTER TABLE files ADD COLUMN language TEXT")
+
+	// 已上传的分片（以存储中 ListParts 的结果为准）
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS file_parts (
+		file_id TEXT NOT NULL,
+		part_number INTEGER NOT NULL,
+		etag TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (file_id, part_number)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 文件合集：多个文件共享一个短链接和过期时间（短码与 files 表共用一个命名空间）
+	_, err = DB.Exec(`
+	CREATE TABLE IF NOT EXISTS bundles (
+		id TEXT PRIMARY KEY,
+		title TEXT,
+		short_code TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		pinned INTEGER DEFAULT 0
+	);
+
+	-- 每个文件最多属于一个合集，original_* 为文件加入合集前的过期时间和固定状态，移出合集或合集删除、过期时恢复
+	CREATE TABLE IF NOT EXISTS bundle_files (
+		file_id TEXT PRIMARY KEY,
+		bundle_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		original_expires_at DATETIME NOT NULL,
+		original_pinned INTEGER NOT NULL DEFAULT 0
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_bundle_files_bundle_id ON bundle_files(bundle_id);
+	`)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"r2box/services"
+)
+
+// AdminHandler 管理操作处理器
+type AdminHandler struct {
+	db      *sql.DB
+	storage services.Storage
+	reaper  *services.Reaper
+}
+
+// NewAdminHandler 创建管理操作处理器
+func NewAdminHandler(db *sql.DB, storage services.Storage, reaper *services.Reaper) *AdminHandler {
+	return &AdminHandler{
+		db:      db,
+		storage: storage,
+		reaper:  reaper,
+	}
+}
+
+// Reconcile 对账存储桶与 files 表
+// GET 仅报告（dry-run）；POST 可通过 delete_orphans / mark_missing 执行修复
+func (h *AdminHandler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	var opts services.ReconcileOptions
+
+	switch r.Method {
+	case http.MethodGet:
+		// dry-run
+	case http.MethodPost:
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+				http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+				return
+			}
+		}
+	default:
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := services.Reconcile(h.db, h.storage, opts)
+	if err != nil {
+		log.Printf("[Admin] 对账失败: %v", err)
+		http.Error(w, `{"error":"对账失败"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// Reap 清理被放弃的上传
+// GET 返回最近一次清理报告；POST 立即执行一次清理
+func (h *AdminHandler) Reap(w http.ResponseWriter, r *http.Request) {
+	var report *services.ReapReport
+
+	switch r.Method {
+	case http.MethodGet:
+		report = h.reaper.LastReport()
+	case http.MethodPost:
+		report = h.reaper.Run(h.storage)
+	default:
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"report": report,
+	})
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"r2box/models"
+	"r2box/services"
+	"strings"
+)
+
+// maxArchiveFiles 单次打包下载的文件数上限
+const maxArchiveFiles = 1000
+
+// Archive 将选中的文件打包为 zip 流式下载（管理员下载，不计入下载次数）
+// GET /api/files/archive?ids=id1,id2,...（也可重复传递 id 参数）
+func (h *FilesHandler) Archive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	var ids []string
+	for _, v := range query["ids"] {
+		ids = append(ids, strings.Split(v, ",")...)
+	}
+	ids = append(ids, query["id"]...)
+	if len(ids) == 0 {
+		http.Error(w, `{"error":"请选择至少一个文件"}`, http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxArchiveFiles {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("一次最多打包 %d 个文件", maxArchiveFiles))
+		return
+	}
+
+	var files []models.File
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		file, err := models.GetFileByID(h.db, id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("文件 %s 不存在", id))
+			return
+		}
+		if file.UploadStatus != "completed" {
+			writeError(w, http.StatusConflict, fmt.Sprintf("文件 %s 不可下载", file.Filename))
+			return
+		}
+		files = append(files, *file)
+	}
+
+	h.writeArchive(w, "r2box-files.zip", files, nil)
+}
+
+// BundleArchive 将合集中可下载的文件打包为 zip 流式下载
+// GET /s/:code/zip，每个文件计入一次下载；受密码保护且未解锁的文件不会被打包
+func (h *FilesHandler) BundleArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	shortCode := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/s/"), "/zip")
+	bundle, err := models.GetBundleByShortCode(h.db, shortCode)
+	if err != nil {
+		http.Error(w, `{"error":"合集不存在"}`, http.StatusNotFound)
+		return
+	}
+	if bundle.Expired() {
+		writeGone(w)
+		return
+	}
+	if err := bundle.LoadFiles(h.db); err != nil {
+		log.Printf("[Files] 获取合集文件失败: %v", err)
+		http.Error(w, `{"error":"获取合集文件失败"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var files []models.File
+	for _, file := range bundle.Files {
+		if file.UploadStatus != "completed" || file.Expired() || file.DownloadsExhausted() {
+			continue
+		}
+		if file.HasPassword && !h.unlocked(r, &file) {
+			continue
+		}
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		writeGone(w)
+		return
+	}
+
+	// 下载次数用完的文件在打包完成后才开始删除倒计时，避免大合集传输途中对象被删除
+	var burned []*models.File
+	defer func() {
+		for _, file := range burned {
+			h.burn(file)
+		}
+	}()
+
+	// 对象确实存在时才计入下载，次数已被并发请求用完的文件跳过
+	admit := func(file *models.File) (bool, error) {
+		ok, err := file.ConsumeDownload(h.db)
+		if err != nil || !ok {
+			return false, err
+		}
+		if file.DownloadsExhausted() {
+			burned = append(burned, file)
+		}
+		return true, nil
+	}
+
+	name := bundle.Title
+	if name == "" {
+		name = bundle.ShortCode
+	}
+	h.writeArchive(w, archiveEntryName(name)+".zip", files, admit)
+}
+
+// writeArchive 逐个读取存储对象并写入 zip 流，不在内存中缓冲整个文件
+// admit 不为 nil 时，在对象读取成功后、写入压缩包前调用，返回 false 的文件被跳过；没有任何文件写入时返回 410
+// 文件不使用压缩（大多为已压缩的媒体或归档文件），总大小或单个文件超过 4GB 时 archive/zip 自动使用 ZIP64
+// 响应开始后出错只能中断连接，客户端会得到不完整的压缩包
+func (h *FilesHandler) writeArchive(w http.ResponseWriter, filename string, files []models.File, admit func(file *models.File) (bool, error)) {
+	zw := zip.NewWriter(w)
+	names := make(map[string]int)
+	var written int64
+	entries := 0
+
+	for i := range files {
+		file := &files[i]
+		body, err := h.storage.GetObject(file.R2Key)
+		if errors.Is(err, services.ErrObjectNotFound) {
+			log.Printf("[Files] 打包时对象不存在，已跳过: %s (%s)", file.Filename, file.ID)
+			continue
+		}
+		if err != nil {
+			log.Printf("[Files] 打包时读取对象失败: %s, %v", file.R2Key, err)
+			abortArchive(w, entries, "读取文件失败")
+			return
+		}
+
+		if admit != nil {
+			ok, err := admit(file)
+			if err != nil {
+				body.Close()
+				log.Printf("[Files] 更新下载次数失败: %v", err)
+				abortArchive(w, entries, "更新下载次数失败")
+				return
+			}
+			if !ok {
+				body.Close()
+				continue
+			}
+		}
+
+		if entries == 0 {
+			setArchiveHeaders(w, filename)
+		}
+		entries++
+
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     uniqueEntryName(names, archiveEntryName(file.Filename)),
+			Method:   zip.Store,
+			Modified: file.CreatedAt,
+		})
+		if err == nil {
+			var n int64
+			n, err = io.Copy(entry, body)
+			written += n
+		}
+		body.Close()
+		if err != nil {
+			log.Printf("[Files] 打包下载中断: %s, %v", file.Filename, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	if entries == 0 {
+		if admit != nil {
+			writeGone(w)
+			return
+		}
+		setArchiveHeaders(w, filename)
+	}
+
+	if err := zw.Close(); err != nil {
+		log.Printf("[Files] 打包下载中断: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	log.Printf("[Files] 打包下载完成: files=%d, size=%d", entries, written)
+}
+
+// setArchiveHeaders 写入压缩包的响应头（在写出第一个文件前设置，此前仍可返回错误响应）
+func setArchiveHeaders(w http.ResponseWriter, filename string) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// abortArchive 打包出错：尚未写出任何内容时返回 500，否则只能中断连接
+func abortArchive(w http.ResponseWriter, entries int, message string) {
+	if entries == 0 {
+		writeError(w, http.StatusInternalServerError, message)
+		return
+	}
+	panic(http.ErrAbortHandler)
+}
+
+// archiveEntryName 去掉文件名中的路径成分，防止解压时写到目标目录之外
+func archiveEntryName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		return "file"
+	}
+	return name
+}
+
+// uniqueEntryName 同名文件依次重命名为 "name (2).ext"、"name (3).ext"
+func uniqueEntryName(names map[string]int, name string) string {
+	names[name]++
+	if names[name] == 1 {
+		return name
+	}
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for {
+		candidate := fmt.Sprintf("%s (%d)%s", base, names[name], ext)
+		if names[candidate] == 0 {
+			names[candidate] = 1
+			return candidate
+		}
+		names[name]++
+	}
+}
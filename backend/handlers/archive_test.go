@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"r2box/database"
+	"r2box/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveEntryName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "report.pdf", want: "report.pdf"},
+		{name: "../../etc/passwd", want: "_.._etc_passwd"},
+		{name: "a/b/c.txt", want: "a_b_c.txt"},
+		{name: `..\..\win.ini`, want: `_.._win.ini`},
+		{name: "/abs/path", want: "_abs_path"},
+		{name: ".bashrc", want: "bashrc"},
+		{name: "..", want: "file"},
+		{name: "", want: "file"},
+		{name: "报告 2024.docx", want: "报告 2024.docx"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := archiveEntryName(tt.name); got != tt.want {
+				t.Fatalf("archiveEntryName(%q) = %q, 期望 %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUniqueEntryName(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{
+			name:  "无重名",
+			input: []string{"a.txt", "b.txt"},
+			want:  []string{"a.txt", "b.txt"},
+		},
+		{
+			name:  "重名依次编号",
+			input: []string{"a.txt", "a.txt", "a.txt"},
+			want:  []string{"a.txt", "a (2).txt", "a (3).txt"},
+		},
+		{
+			name:  "无扩展名",
+			input: []string{"README", "README"},
+			want:  []string{"README", "README (2)"},
+		},
+		{
+			name:  "跳过已存在的编号",
+			input: []string{"a (2).txt", "a.txt", "a.txt"},
+			want:  []string{"a (2).txt", "a.txt", "a (3).txt"},
+		},
+		{
+			name:  "编号后的名称再次重名",
+			input: []string{"a.txt", "a.txt", "a (2).txt"},
+			want:  []string{"a.txt", "a (2).txt", "a (2) (2).txt"},
+		},
+		{
+			name:  "多重扩展名只保留最后一段",
+			input: []string{"x.tar.gz", "x.tar.gz"},
+			want:  []string{"x.tar.gz", "x.tar (2).gz"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := map[string]int{}
+			for i, input := range tt.input {
+				if got := uniqueEntryName(names, input); got != tt.want[i] {
+					t.Fatalf("第 %d 个 uniqueEntryName(%q) = %q, 期望 %q", i+1, input, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBundleArchiveCountsOnlyWrittenFiles(t *testing.T) {
+	_, files, storage := newMemoryHandlers(t)
+
+	// stored 的对象存在；missing 的对象已丢失，不应被计入下载而焚毁
+	newFile := func(name string, store bool) *models.File {
+		f := &models.File{Filename: name, Size: 5, ContentType: "text/plain", MaxDownloads: 1, UploadStatus: "completed", Lifetime: time.Hour}
+		if err := f.Create(database.DB); err != nil {
+			t.Fatalf("创建文件记录失败: %v", err)
+		}
+		if store {
+			if _, err := storage.PutObject(f.R2Key, f.ContentType, strings.NewReader("hello"), f.Size); err != nil {
+				t.Fatalf("写入对象失败: %v", err)
+			}
+		}
+		return f
+	}
+	stored := newFile("stored.txt", true)
+	missing := newFile("missing.txt", false)
+
+	bundle := &models.Bundle{ShortCode: "archive-test", Lifetime: time.Hour}
+	if err := bundle.Create(database.DB, []string{stored.ID, missing.ID}); err != nil {
+		t.Fatalf("创建合集失败: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	files.BundleArchive(rec, httptest.NewRequest(http.MethodGet, "/s/archive-test/zip", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("状态码 %d, 期望 200: %s", rec.Code, rec.Body.String())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("解析压缩包失败: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "stored.txt" {
+		t.Fatalf("压缩包内容不符: %d 个文件", len(zr.File))
+	}
+
+	tests := []struct {
+		file       *models.File
+		wantCount  int
+		wantStatus string
+	}{
+		{file: stored, wantCount: 1, wantStatus: "burned"},
+		{file: missing, wantCount: 0, wantStatus: "completed"},
+	}
+	for _, tt := range tests {
+		f, err := models.GetFileByID(database.DB, tt.file.ID)
+		if err != nil {
+			t.Fatalf("读取文件记录失败: %v", err)
+		}
+		if f.DownloadCount != tt.wantCount || f.UploadStatus != tt.wantStatus {
+			t.Fatalf("%s: download_count=%d status=%s, 期望 %d %s", f.Filename, f.DownloadCount, f.UploadStatus, tt.wantCount, tt.wantStatus)
+		}
+	}
+
+	// 只剩对象丢失的文件时不返回空压缩包
+	rec = httptest.NewRecorder()
+	files.BundleArchive(rec, httptest.NewRequest(http.MethodGet, "/s/archive-test/zip", nil))
+	if rec.Code != http.StatusGone {
+		t.Fatalf("状态码 %d, 期望 410", rec.Code)
+	}
+}
@@ -8,16 +8,18 @@ import (
 	"net/http"
 	"r2box/database"
 	"r2box/middleware"
+	"r2box/services"
 )
 
 // AuthHandler 认证处理器
 type AuthHandler struct {
-	db *sql.DB
+	db             *sql.DB
+	storageBackend string
 }
 
 // NewAuthHandler 创建认证处理器
-func NewAuthHandler(db *sql.DB) *AuthHandler {
-	return &AuthHandler{db: db}
+func NewAuthHandler(db *sql.DB, storageBackend string) *AuthHandler {
+	return &AuthHandler{db: db, storageBackend: storageBackend}
 }
 
 // LoginRequest 登录请求
@@ -65,7 +67,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 检查是否需要配置 R2
-	needSetup := !checkR2Configured(h.db)
+	needSetup := h.needSetup()
 
 	// 设置 Cookie
 	http.SetCookie(w, &http.Cookie{
@@ -124,7 +126,7 @@ func (h *AuthHandler) SetupPassword(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":    true,
-		"need_setup": true,
+		"need_setup": h.needSetup(),
 	})
 }
 
@@ -148,7 +150,7 @@ func (h *AuthHandler) Status(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	needSetup := !checkR2Configured(h.db)
+	needSetup := h.needSetup()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -157,6 +159,11 @@ func (h *AuthHandler) Status(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// needSetup 是否需要进入 R2 配置向导（仅 R2 后端需要）
+func (h *AuthHandler) needSetup() bool {
+	return h.storageBackend == services.BackendR2 && !checkR2Configured(h.db)
+}
+
 func checkR2Configured(db *sql.DB) bool {
 	var r2Configured string
 	err := db.QueryRow("SELECT value FROM system_config WHERE key = 'r2_configured'").Scan(&r2Configured)
@@ -168,12 +175,7 @@ func hashPassword(password string) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// getClientIP 获取客户端 IP，与速率限制中间件的规则一致，失败记录才能计入同一 IP
 func getClientIP(r *http.Request) string {
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		return xff
-	}
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-	return r.RemoteAddr
+	return middleware.ClientIP(r)
 }
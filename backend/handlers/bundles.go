@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"r2box/config"
+	"r2box/models"
+	"strings"
+	"time"
+)
+
+// BundlesHandler 文件合集处理器
+type BundlesHandler struct {
+	db     *sql.DB
+	expiry expiryPolicy
+}
+
+// NewBundlesHandler 创建文件合集处理器
+func NewBundlesHandler(db *sql.DB, cfg *config.Config) *BundlesHandler {
+	return &BundlesHandler{
+		db:     db,
+		expiry: newExpiryPolicy(cfg),
+	}
+}
+
+// CreateBundleRequest 创建合集请求
+type CreateBundleRequest struct {
+	Title     string      `json:"title"`
+	FileIDs   []string    `json:"file_ids"`
+	ExpiresIn expiryValue `json:"expires_in"` // 有效期，格式同上传接口，"never" 表示永不过期
+	ExpiresAt string      `json:"expires_at"` // 绝对过期时间（RFC3339），与 expires_in 二选一
+	ShortCode string      `json:"short_code,omitempty"`
+}
+
+// BundleFilesRequest 向合集追加文件请求
+type BundleFilesRequest struct {
+	FileIDs []string `json:"file_ids"`
+}
+
+// BundleResponse 合集信息（附带短链接）
+type BundleResponse struct {
+	models.Bundle
+	ShortURL string `json:"short_url"`
+}
+
+// List 获取合集列表
+// GET /api/bundles
+func (h *BundlesHandler) List(w http.ResponseWriter, r *http.Request) {
+	bundles, err := models.ListBundles(h.db)
+	if err != nil {
+		log.Printf("[Bundles] 获取合集列表失败: %v", err)
+		http.Error(w, `{"error":"获取合集列表失败"}`, http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]BundleResponse, len(bundles))
+	for i, b := range bundles {
+		items[i] = BundleResponse{Bundle: b, ShortURL: requestBaseURL(r) + "/s/" + b.ShortCode}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bundles": items,
+	})
+}
+
+// Create 创建合集，合集中的文件共享一个短链接和过期时间
+// POST /api/bundles
+func (h *BundlesHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req CreateBundleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.FileIDs) == 0 {
+		http.Error(w, `{"error":"请选择至少一个文件"}`, http.StatusBadRequest)
+		return
+	}
+
+	bundle := &models.Bundle{Title: strings.TrimSpace(req.Title)}
+	lifetime, never, err := h.expiry.lifetime(string(req.ExpiresIn), req.ExpiresAt)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bundle.Lifetime = lifetime
+	bundle.Pinned = never
+
+	if code := strings.TrimSpace(req.ShortCode); code != "" {
+		if err := models.ValidateShortCode(code); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		bundle.ShortCode = code
+	}
+
+	if err := bundle.Create(h.db, req.FileIDs); err != nil {
+		writeBundleError(w, err, "创建合集失败")
+		return
+	}
+
+	log.Printf("[Bundles] 合集已创建: id=%s, short_code=%s, files=%d", bundle.ID, bundle.ShortCode, bundle.FileCount)
+	h.writeBundle(w, r, bundle)
+}
+
+// Get 获取合集详情（包含文件列表）
+// GET /api/bundles/:id
+func (h *BundlesHandler) Get(w http.ResponseWriter, r *http.Request) {
+	bundle, ok := h.getBundle(w, r)
+	if !ok {
+		return
+	}
+	h.writeBundle(w, r, bundle)
+}
+
+// Delete 删除合集，其中的文件保留并恢复加入合集前的过期时间和固定状态
+// DELETE /api/bundles/:id
+func (h *BundlesHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	bundle, ok := h.getBundle(w, r)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteBundle(h.db, bundle.ID); err != nil {
+		log.Printf("[Bundles] 删除合集失败: %v", err)
+		http.Error(w, `{"error":"删除合集失败"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[Bundles] 合集已删除: id=%s", bundle.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "合集已删除",
+	})
+}
+
+// AddFiles 向合集追加文件
+// POST /api/bundles/:id/files
+func (h *BundlesHandler) AddFiles(w http.ResponseWriter, r *http.Request) {
+	bundle, ok := h.getBundle(w, r)
+	if !ok {
+		return
+	}
+
+	var req BundleFilesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.FileIDs) == 0 {
+		http.Error(w, `{"error":"请选择至少一个文件"}`, http.StatusBadRequest)
+		return
+	}
+	if bundle.Expired() {
+		writeGone(w)
+		return
+	}
+
+	if err := bundle.AddFiles(h.db, req.FileIDs); err != nil {
+		writeBundleError(w, err, "添加文件失败")
+		return
+	}
+
+	log.Printf("[Bundles] 已向合集添加文件: id=%s, files=%d", bundle.ID, bundle.FileCount)
+	h.writeBundle(w, r, bundle)
+}
+
+// RemoveFile 从合集移除文件，文件本身保留并恢复加入合集前的过期时间和固定状态
+// DELETE /api/bundles/:id/files/:file_id
+func (h *BundlesHandler) RemoveFile(w http.ResponseWriter, r *http.Request) {
+	bundle, ok := h.getBundle(w, r)
+	if !ok {
+		return
+	}
+
+	// /api/bundles/:id/files/:file_id
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 6 || parts[5] == "" {
+		http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+		return
+	}
+
+	removed, err := bundle.RemoveFile(h.db, parts[5])
+	if err != nil {
+		log.Printf("[Bundles] 移除文件失败: %v", err)
+		http.Error(w, `{"error":"移除文件失败"}`, http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, `{"error":"文件不在该合集中"}`, http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[Bundles] 已从合集移除文件: id=%s, file_id=%s", bundle.ID, parts[5])
+	h.writeBundle(w, r, bundle)
+}
+
+// getBundle 根据 URL 中的合集 ID 获取合集，不存在时写入 404
+func (h *BundlesHandler) getBundle(w http.ResponseWriter, r *http.Request) (*models.Bundle, bool) {
+	// /api/bundles/:id[/files[/:file_id]]
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 4 || parts[3] == "" {
+		http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+		return nil, false
+	}
+
+	bundle, err := models.GetBundleByID(h.db, parts[3])
+	if err != nil {
+		http.Error(w, `{"error":"合集不存在"}`, http.StatusNotFound)
+		return nil, false
+	}
+	return bundle, true
+}
+
+// writeBundle 返回合集详情（包含文件列表）
+func (h *BundlesHandler) writeBundle(w http.ResponseWriter, r *http.Request, bundle *models.Bundle) {
+	if err := bundle.LoadFiles(h.db); err != nil {
+		log.Printf("[Bundles] 获取合集文件失败: %v", err)
+		http.Error(w, `{"error":"获取合集文件失败"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BundleResponse{
+		Bundle:   *bundle,
+		ShortURL: requestBaseURL(r) + "/s/" + bundle.ShortCode,
+	})
+}
+
+// writeBundleError 返回创建合集或添加文件失败的错误
+func writeBundleError(w http.ResponseWriter, err error, message string) {
+	var fileErr *models.BundleFileError
+	if errors.As(err, &fileErr) {
+		writeError(w, http.StatusBadRequest, fileErr.Error())
+		return
+	}
+	var takenErr *models.ShortCodeTakenError
+	if errors.As(err, &takenErr) {
+		writeShortCodeTaken(w, takenErr)
+		return
+	}
+	log.Printf("[Bundles] %s: %v", message, err)
+	writeError(w, http.StatusInternalServerError, message)
+}
+
+// BundlePage 合集短链接的落地内容
+type BundlePage struct {
+	Title      string           `json:"title"`
+	ShortCode  string           `json:"short_code"`
+	ArchiveURL string           `json:"archive_url"`          // 打包下载全部文件
+	ExpiresAt  *time.Time       `json:"expires_at,omitempty"` // 固定的合集永不过期，不返回
+	Files      []BundlePageFile `json:"files"`
+}
+
+// BundlePageFile 合集中可下载的文件
+type BundlePageFile struct {
+	Filename      string `json:"filename"`
+	Size          int64  `json:"size"`
+	SizeFormatted string `json:"size_formatted"`
+	ContentType   string `json:"content_type"`
+	HasPassword   bool   `json:"has_password"`
+	ShortURL      string `json:"short_url"` // 单个文件的短链接，下载计数和密码保护照常生效
+}
+
+// serveBundle 合集短链接：浏览器访问时展示文件列表页面，API 请求返回 JSON
+// 已删除、已过期或下载次数已用完的文件不会列出
+func (h *FilesHandler) serveBundle(w http.ResponseWriter, r *http.Request, bundle *models.Bundle) {
+	if bundle.Expired() {
+		writeGone(w)
+		return
+	}
+	if err := bundle.LoadFiles(h.db); err != nil {
+		log.Printf("[Files] 获取合集文件失败: %v", err)
+		http.Error(w, `{"error":"获取合集文件失败"}`, http.StatusInternalServerError)
+		return
+	}
+
+	page := BundlePage{
+		Title:      bundle.Title,
+		ShortCode:  bundle.ShortCode,
+		ArchiveURL: requestBaseURL(r) + "/s/" + bundle.ShortCode + "/zip",
+		Files:      []BundlePageFile{},
+	}
+	if !bundle.Pinned {
+		page.ExpiresAt = &bundle.ExpiresAt
+	}
+	for _, f := range bundle.Files {
+		if f.UploadStatus != "completed" || f.Expired() || f.DownloadsExhausted() {
+			continue
+		}
+		page.Files = append(page.Files, BundlePageFile{
+			Filename:      f.Filename,
+			Size:          f.Size,
+			SizeFormatted: models.FormatBytes(f.Size),
+			ContentType:   f.ContentType,
+			HasPassword:   f.HasPassword,
+			ShortURL:      requestBaseURL(r) + "/s/" + f.ShortCode,
+		})
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := bundlePage.Execute(w, page); err != nil {
+		log.Printf("[Files] 渲染合集页面失败: %v", err)
+	}
+}
+
+// bundlePage 合集文件列表页面
+var bundlePage = template.Must(template.New("bundle").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Title}}{{.Title}}{{else}}{{len .Files}} 个文件{{end}} - R2Box</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #f5f7fa; display: flex; justify-content: center; margin: 0; padding: 48px 16px; }
+main { background: #fff; padding: 32px; border-radius: 16px; box-shadow: 0 4px 24px rgba(0,0,0,.08); width: 100%; max-width: 560px; }
+h1 { font-size: 18px; margin: 0 0 8px; word-break: break-all; }
+p { color: #666; font-size: 14px; margin: 0 0 16px; }
+ul { list-style: none; padding: 0; margin: 0; }
+li { display: flex; align-items: center; gap: 12px; padding: 12px 0; border-top: 1px solid #eee; font-size: 14px; }
+.name { flex: 1; word-break: break-all; }
+.size { color: #999; white-space: nowrap; }
+a { color: #18a058; text-decoration: none; white-space: nowrap; }
+.all { display: block; margin-top: 16px; padding: 10px 12px; border-radius: 8px; background: #18a058; color: #fff; text-align: center; }
+</style>
+</head>
+<body>
+<main>
+<h1>📦 {{if .Title}}{{.Title}}{{else}}{{len .Files}} 个文件{{end}}</h1>
+<p>{{if .ExpiresAt}}有效期至 {{.ExpiresAt.Format "2006-01-02 15:04"}}{{else}}永久有效{{end}}</p>
+{{if .Files}}<ul>
+{{range .Files}}<li><span class="name">{{if .HasPassword}}🔒 {{end}}{{.Filename}}</span><span class="size">{{.SizeFormatted}}</span><a href="{{.ShortURL}}?dl=1">下载</a></li>
+{{end}}</ul>
+<a class="all" href="{{.ArchiveURL}}">打包下载全部</a>{{else}}<p>合集中暂无可下载的文件</p>{{end}}
+</main>
+</body>
+</html>
+`))
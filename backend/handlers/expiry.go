@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"r2box/config"
+	"r2box/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expiryPolicy 文件过期时间策略（最短、最长时长、默认值和预设选项均由配置决定）
+type expiryPolicy struct {
+	min         time.Duration
+	max         time.Duration
+	def         time.Duration
+	presets     []time.Duration
+	presetsOnly bool
+	allowNever  bool
+}
+
+// expiryNever 表示永不过期的 expires_in 取值
+const expiryNever = "never"
+
+// newExpiryPolicy 从配置创建过期时间策略
+func newExpiryPolicy(cfg *config.Config) expiryPolicy {
+	return expiryPolicy{
+		min:         cfg.ExpiryMin,
+		max:         cfg.ExpiryMax,
+		def:         cfg.ExpiryDefault,
+		presets:     cfg.ExpiryPresets,
+		presetsOnly: cfg.ExpiryPresetsOnly,
+		allowNever:  cfg.ExpiryAllowNever,
+	}
+}
+
+// apply 解析请求中的有效期并写入文件记录
+// expires_in 为 "never" 时文件被固定，永不过期（过期时间仍按默认值记录，取消固定后生效）
+func (p expiryPolicy) apply(file *models.File, expiresIn, expiresAt string) error {
+	lifetime, never, err := p.lifetime(expiresIn, expiresAt)
+	if err != nil {
+		return err
+	}
+	file.Lifetime = lifetime
+	file.Pinned = never
+	return nil
+}
+
+// lifetime 解析有效期，never 表示永不过期（此时 lifetime 为默认值）
+func (p expiryPolicy) lifetime(expiresIn, expiresAt string) (lifetime time.Duration, never bool, err error) {
+	if strings.EqualFold(strings.TrimSpace(expiresIn), expiryNever) {
+		if !p.allowNever {
+			return 0, false, fmt.Errorf("不允许上传永不过期的文件")
+		}
+		if strings.TrimSpace(expiresAt) != "" {
+			return 0, false, fmt.Errorf("expires_in 和 expires_at 只能指定一个")
+		}
+		return p.def, true, nil
+	}
+
+	lifetime, err = p.resolve(expiresIn, expiresAt)
+	return lifetime, false, err
+}
+
+// resolve 解析文件有效期
+// expiresAt 为绝对时间（RFC3339）；expiresIn 为时长（如 "90m"、"12h"、"14d"），纯数字按天数处理以兼容旧客户端
+// 两者都为空时使用默认值；无效、超出允许范围或不在预设中时返回错误
+func (p expiryPolicy) resolve(expiresIn, expiresAt string) (time.Duration, error) {
+	expiresIn = strings.TrimSpace(expiresIn)
+	expiresAt = strings.TrimSpace(expiresAt)
+
+	var lifetime time.Duration
+	switch {
+	case expiresAt != "":
+		if expiresIn != "" {
+			return 0, fmt.Errorf("expires_in 和 expires_at 只能指定一个")
+		}
+		t, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return 0, fmt.Errorf("无效的过期时间: %s（应为 RFC3339 格式，如 2024-01-02T15:04:05+08:00）", expiresAt)
+		}
+		lifetime = time.Until(t).Round(time.Second)
+	case expiresIn != "":
+		if days, err := strconv.ParseFloat(expiresIn, 64); err == nil {
+			lifetime = time.Duration(days * float64(24*time.Hour))
+		} else {
+			d, err := config.ParseDuration(expiresIn)
+			if err != nil {
+				return 0, fmt.Errorf("无效的过期时间: %s（示例: 90m、12h、14d）", expiresIn)
+			}
+			lifetime = d
+		}
+	default:
+		return p.def, nil
+	}
+
+	if p.presetsOnly {
+		for _, preset := range p.presets {
+			if lifetime == preset {
+				return lifetime, nil
+			}
+		}
+		return 0, fmt.Errorf("过期时间只能选择: %s", strings.Join(p.presetLabels(), "、"))
+	}
+
+	if lifetime < p.min || lifetime > p.max {
+		return 0, fmt.Errorf("过期时间必须在 %s 到 %s 之间", config.FormatDuration(p.min), config.FormatDuration(p.max))
+	}
+	return lifetime, nil
+}
+
+// presetLabels 预设选项的文本形式
+func (p expiryPolicy) presetLabels() []string {
+	labels := make([]string, len(p.presets))
+	for i, preset := range p.presets {
+		labels[i] = config.FormatDuration(preset)
+	}
+	return labels
+}
+
+// ExpiryOptions 过期时间选项（供前端展示）
+type ExpiryOptions struct {
+	Min         string   `json:"min"`
+	Max         string   `json:"max"`
+	Default     string   `json:"default"`
+	Presets     []string `json:"presets"`
+	PresetsOnly bool     `json:"presets_only"`
+	AllowNever  bool     `json:"allow_never"`
+}
+
+// options 导出策略供前端展示
+func (p expiryPolicy) options() ExpiryOptions {
+	return ExpiryOptions{
+		Min:         config.FormatDuration(p.min),
+		Max:         config.FormatDuration(p.max),
+		Default:     config.FormatDuration(p.def),
+		Presets:     p.presetLabels(),
+		PresetsOnly: p.presetsOnly,
+		AllowNever:  p.allowNever,
+	}
+}
+
+// expiryValue 请求中的 expires_in，兼容数字（天数）和字符串（时长）两种写法
+type expiryValue string
+
+// UnmarshalJSON 解析数字或字符串
+func (v *expiryValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = expiryValue(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("expires_in 必须为数字或字符串")
+	}
+	*v = expiryValue(n.String())
+	return nil
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"r2box/models"
+	"testing"
+	"time"
+)
+
+func TestExpiryPolicyResolve(t *testing.T) {
+	const day = 24 * time.Hour
+
+	policy := expiryPolicy{
+		min:     time.Hour,
+		max:     30 * day,
+		def:     7 * day,
+		presets: []time.Duration{day, 7 * day},
+	}
+	presetsOnly := policy
+	presetsOnly.presetsOnly = true
+
+	inTwoDays := time.Now().Add(2 * day).Format(time.RFC3339)
+	tooFar := time.Now().Add(60 * day).Format(time.RFC3339)
+
+	tests := []struct {
+		name      string
+		policy    expiryPolicy
+		expiresIn string
+		expiresAt string
+		want      time.Duration
+		wantErr   bool
+	}{
+		{name: "默认值", policy: policy, want: 7 * day},
+		{name: "分钟", policy: policy, expiresIn: "90m", want: 90 * time.Minute},
+		{name: "天", policy: policy, expiresIn: "14d", want: 14 * day},
+		{name: "组合单位", policy: policy, expiresIn: "1d12h", want: 36 * time.Hour},
+		{name: "纯数字按天数", policy: policy, expiresIn: "3", want: 3 * day},
+		{name: "小数天数", policy: policy, expiresIn: "0.5", want: 12 * time.Hour},
+		{name: "首尾空白", policy: policy, expiresIn: " 2h ", want: 2 * time.Hour},
+		{name: "RFC3339", policy: policy, expiresAt: inTwoDays, want: 2 * day},
+		{name: "低于最短时长", policy: policy, expiresIn: "30m", wantErr: true},
+		{name: "恰好最短时长", policy: policy, expiresIn: "1h", want: time.Hour},
+		{name: "恰好最长时长", policy: policy, expiresIn: "30d", want: 30 * day},
+		{name: "超过最长时长", policy: policy, expiresIn: "31d", wantErr: true},
+		{name: "负数", policy: policy, expiresIn: "-30", wantErr: true},
+		{name: "无效时长", policy: policy, expiresIn: "soon", wantErr: true},
+		{name: "无效时间", policy: policy, expiresAt: "2024-01-02 15:04", wantErr: true},
+		{name: "过期时间超过最长时长", policy: policy, expiresAt: tooFar, wantErr: true},
+		{name: "同时指定两者", policy: policy, expiresIn: "1d", expiresAt: inTwoDays, wantErr: true},
+		{name: "仅预设: 命中", policy: presetsOnly, expiresIn: "24h", want: day},
+		{name: "仅预设: 纯数字命中", policy: presetsOnly, expiresIn: "7", want: 7 * day},
+		{name: "仅预设: 未命中", policy: presetsOnly, expiresIn: "2d", wantErr: true},
+		{name: "仅预设: 默认值", policy: presetsOnly, want: 7 * day},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.resolve(tt.expiresIn, tt.expiresAt)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolve(%q, %q) = %v, 期望返回错误", tt.expiresIn, tt.expiresAt, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolve(%q, %q) 失败: %v", tt.expiresIn, tt.expiresAt, err)
+			}
+			// RFC3339 只精确到秒，允许少量误差
+			if diff := got - tt.want; diff < -2*time.Second || diff > 2*time.Second {
+				t.Fatalf("resolve(%q, %q) = %v, 期望 %v", tt.expiresIn, tt.expiresAt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiryValueUnmarshal(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    expiryValue
+		wantErr bool
+	}{
+		{data: `7`, want: "7"},
+		{data: `0.5`, want: "0.5"},
+		{data: `"90m"`, want: "90m"},
+		{data: `"never"`, want: "never"},
+		{data: `true`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			var v expiryValue
+			err := v.UnmarshalJSON([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalJSON(%s) err = %v, wantErr %v", tt.data, err, tt.wantErr)
+			}
+			if !tt.wantErr && v != tt.want {
+				t.Fatalf("UnmarshalJSON(%s) = %q, 期望 %q", tt.data, v, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiryPolicyNever(t *testing.T) {
+	const day = 24 * time.Hour
+
+	policy := expiryPolicy{min: time.Hour, max: 30 * day, def: 7 * day, allowNever: true}
+	noNever := policy
+	noNever.allowNever = false
+
+	tests := []struct {
+		name       string
+		policy     expiryPolicy
+		expiresIn  string
+		expiresAt  string
+		wantPinned bool
+		wantErr    bool
+	}{
+		{name: "永不过期", policy: policy, expiresIn: "never", wantPinned: true},
+		{name: "不区分大小写", policy: policy, expiresIn: " NEVER ", wantPinned: true},
+		{name: "普通时长不固定", policy: policy, expiresIn: "1d"},
+		{name: "同时指定时间", policy: policy, expiresIn: "never", expiresAt: time.Now().Add(day).Format(time.RFC3339), wantErr: true},
+		{name: "不允许永不过期", policy: noNever, expiresIn: "never", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &models.File{}
+			err := tt.policy.apply(file, tt.expiresIn, tt.expiresAt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply(%q, %q) err = %v, wantErr %v", tt.expiresIn, tt.expiresAt, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if file.Pinned != tt.wantPinned {
+				t.Fatalf("Pinned = %v, 期望 %v", file.Pinned, tt.wantPinned)
+			}
+			// 永不过期的文件仍按默认有效期记录过期时间，取消固定后生效
+			if tt.wantPinned && file.Lifetime != tt.policy.def {
+				t.Fatalf("Lifetime = %v, 期望默认值 %v", file.Lifetime, tt.policy.def)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
 	"r2box/models"
 	"r2box/services"
@@ -13,15 +14,17 @@ import (
 
 // FilesHandler 文件管理处理器
 type FilesHandler struct {
-	db        *sql.DB
-	r2Service *services.R2Service
+	db      *sql.DB
+	storage services.Storage
+	share   shareSigner
 }
 
-// NewFilesHandler 创建文件管理处理器
-func NewFilesHandler(db *sql.DB, r2Service *services.R2Service) *FilesHandler {
+// NewFilesHandler 创建文件管理处理器，secret 用于签发受密码保护文件的解锁令牌
+func NewFilesHandler(db *sql.DB, storage services.Storage, secret []byte) *FilesHandler {
 	return &FilesHandler{
-		db:        db,
-		r2Service: r2Service,
+		db:      db,
+		storage: storage,
+		share:   shareSigner{secret: secret},
 	}
 }
 
@@ -29,6 +32,7 @@ func NewFilesHandler(db *sql.DB, r2Service *services.R2Service) *FilesHandler {
 type FileListItemWithURL struct {
 	models.FileListItem
 	DownloadURL string `json:"download_url"`
+	PreviewURL  string `json:"preview_url,omitempty"` // 内联预览链接，仅图片、音视频和 PDF
 }
 
 // ListResponse 文件列表响应
@@ -70,11 +74,14 @@ func (h *FilesHandler) List(w http.ResponseWriter, r *http.Request) {
 		filesWithURL[i] = FileListItemWithURL{
 			FileListItem: file,
 		}
-		// 只为未过期且已完成的文件生成直链
-		if file.UploadStatus == "completed" && time.Now().Before(file.ExpiresAt) {
-			downloadURL, err := h.r2Service.GenerateDownloadURL(file.R2Key, file.Filename, time.Until(file.ExpiresAt))
+		// 只为未过期且已完成的文件生成直链（限制下载次数的文件必须经由下载接口计数）
+		if file.MaxDownloads > 0 && file.UploadStatus == "completed" {
+			filesWithURL[i].DownloadURL = "/api/files/" + file.ID + "/download"
+		} else if file.UploadStatus == "completed" && !file.Expired() {
+			downloadURL, err := h.storage.GenerateDownloadURL(file.R2Key, file.Filename, file.LinkTTL())
 			if err == nil {
 				filesWithURL[i].DownloadURL = downloadURL
+				_, filesWithURL[i].PreviewURL = h.previewURL(&file.File)
 			} else {
 				// 生成失败时使用备用链接
 				filesWithURL[i].DownloadURL = "/api/files/" + file.ID + "/download"
@@ -114,14 +121,56 @@ func (h *FilesHandler) GetDownloadURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 检查文件是否已过期
-	if time.Now().After(file.ExpiresAt) {
-		http.Error(w, `{"error":"文件已过期"}`, http.StatusGone)
+	h.serveDownload(w, r, file)
+}
+
+// ShortLink 短链接访问：/s/:code 展示文件落地页，?dl=1 或命令行工具访问时直接重定向到下载直链
+// 文本片段展示文本页面，合集短链接展示文件列表
+func (h *FilesHandler) ShortLink(w http.ResponseWriter, r *http.Request) {
+	shortCode := strings.TrimPrefix(r.URL.Path, "/s/")
+	if shortCode == "" {
+		http.Error(w, "短码不能为空", http.StatusBadRequest)
+		return
+	}
+
+	file, err := models.GetFileByShortCode(h.db, shortCode)
+	if err != nil {
+		if bundle, err := models.GetBundleByShortCode(h.db, shortCode); err == nil {
+			h.serveBundle(w, r, bundle)
+			return
+		}
+		http.Error(w, "文件不存在", http.StatusNotFound)
+		return
+	}
+
+	if file.Kind == models.KindPaste {
+		h.servePaste(w, r, file)
+		return
+	}
+	if !wantsDirectDownload(r) {
+		h.serveLanding(w, r, file)
 		return
 	}
+	h.serveDownload(w, r, file)
+}
+
+// burnLinkTTL 最后一次下载的直链有效期，过期后清理任务删除对象（阅后即焚）
+const burnLinkTTL = 5 * time.Minute
+
+// serveDownload 计数一次下载并重定向到预签名直链（使用原始文件名）
+// 已过期、已删除或下载次数已用完的文件返回 410，受密码保护且未解锁的文件要求输入密码
+func (h *FilesHandler) serveDownload(w http.ResponseWriter, r *http.Request, file *models.File) {
+	if !h.admitDownload(w, r, file) {
+		return
+	}
+
+	linkTTL := 24 * time.Hour
+	if file.DownloadsExhausted() {
+		linkTTL = burnLinkTTL
+		h.burn(file)
+	}
 
-	// 生成下载预签名 URL（使用原始文件名）
-	downloadURL, err := h.r2Service.GenerateDownloadURL(file.R2Key, file.Filename, 24*time.Hour)
+	downloadURL, err := h.storage.GenerateDownloadURL(file.R2Key, file.Filename, linkTTL)
 	if err != nil {
 		http.Error(w, `{"error":"生成下载 URL 失败"}`, http.StatusInternalServerError)
 		return
@@ -131,6 +180,66 @@ func (h *FilesHandler) GetDownloadURL(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, downloadURL, http.StatusFound)
 }
 
+// admitDownload 检查文件是否可下载并计数一次下载，不可下载时写入响应并返回 false
+func (h *FilesHandler) admitDownload(w http.ResponseWriter, r *http.Request, file *models.File) bool {
+	if !h.admitView(w, r, file) {
+		return false
+	}
+
+	// 原子计数，并发下载时只有次数内的请求能成功
+	ok, err := file.ConsumeDownload(h.db)
+	if err != nil {
+		log.Printf("[Files] 更新下载次数失败: %v", err)
+		http.Error(w, `{"error":"更新下载次数失败"}`, http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		writeGone(w)
+		return false
+	}
+	return true
+}
+
+// admitView 检查文件是否仍可访问（不计数），不可访问时写入响应并返回 false
+func (h *FilesHandler) admitView(w http.ResponseWriter, r *http.Request, file *models.File) bool {
+	// 对账时发现对象已丢失
+	if file.UploadStatus == "missing" {
+		http.Error(w, `{"error":"文件对象已丢失"}`, http.StatusNotFound)
+		return false
+	}
+
+	if fileGone(file) {
+		writeGone(w)
+		return false
+	}
+
+	// 受密码保护的文件需先解锁
+	if file.HasPassword && !h.unlocked(r, file) {
+		requireUnlock(w, r, file)
+		return false
+	}
+	return true
+}
+
+// burn 下载次数用完后将文件标记为 burned，最后一次的直链失效后由清理任务删除对象并将记录标记为已删除
+func (h *FilesHandler) burn(file *models.File) {
+	if err := file.MarkBurned(h.db, time.Now().Add(burnLinkTTL)); err != nil {
+		log.Printf("[Files] 标记文件为 burned 失败: file_id=%s, %v", file.ID, err)
+		return
+	}
+	log.Printf("[Files] 下载次数已用完，文件将在 %s 后删除: %s (%s)", burnLinkTTL, file.Filename, file.ID)
+}
+
+// fileGone 文件是否已不可下载：已过期、已删除和下载次数已用完的文件返回相同的响应（固定的文件永不过期）
+func fileGone(file *models.File) bool {
+	return file.UploadStatus == "deleted" || file.UploadStatus == "burned" || file.Expired() || file.DownloadsExhausted()
+}
+
+// writeGone 文件已不可下载（过期、已删除或下载次数用完）
+func writeGone(w http.ResponseWriter) {
+	http.Error(w, `{"error":"文件已过期"}`, http.StatusGone)
+}
+
 // Delete 删除文件
 func (h *FilesHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
@@ -154,8 +263,8 @@ func (h *FilesHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 从 R2 删除对象
-	if err := h.r2Service.DeleteObject(file.R2Key); err != nil {
+	// 从存储删除对象
+	if err := h.storage.DeleteObject(file.R2Key); err != nil {
 		http.Error(w, `{"error":"删除文件失败"}`, http.StatusInternalServerError)
 		return
 	}
@@ -172,3 +281,52 @@ func (h *FilesHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		"message": "文件已删除",
 	})
 }
+
+// Pin 固定或取消固定文件
+// POST /api/files/:id/pin 固定（永不过期），DELETE /api/files/:id/pin 取消固定
+func (h *FilesHandler) Pin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 从 URL 路径中提取文件 ID
+	// /api/files/:id/pin
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 5 {
+		http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+		return
+	}
+	fileID := parts[3]
+
+	file, err := models.GetFileByID(h.db, fileID)
+	if err != nil {
+		http.Error(w, `{"error":"文件不存在"}`, http.StatusNotFound)
+		return
+	}
+
+	if file.UploadStatus != "completed" {
+		http.Error(w, `{"error":"只能固定已上传完成的文件"}`, http.StatusConflict)
+		return
+	}
+	if file.DownloadsExhausted() {
+		http.Error(w, `{"error":"下载次数已用完，文件即将删除"}`, http.StatusConflict)
+		return
+	}
+
+	pinned := r.Method == http.MethodPost
+	if err := file.SetPinned(h.db, pinned); err != nil {
+		log.Printf("[Files] 更新固定状态失败: %v", err)
+		http.Error(w, `{"error":"更新固定状态失败"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[Files] 文件固定状态已更新: file_id=%s, pinned=%v", file.ID, pinned)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"pinned":     file.Pinned,
+		"expires_at": file.ExpiresAt.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"html"
+	"html/template"
+	"path"
+	"strings"
+)
+
+// syntax 文本片段语法高亮所需的语言规则
+type syntax struct {
+	name         string
+	ext          string   // 默认扩展名（粘贴时未指定文件名时使用）
+	aliases      []string // 语言别名和扩展名
+	keywords     []string
+	lineComments []string
+	blockComment [2]string
+	quotes       string // 字符串定界符
+	tripleQuotes bool   // 支持 """ 和 ''' 多行字符串
+	lineBased    bool   // 按行着色（diff）
+	plain        bool   // 不着色
+}
+
+// literals 各语言通用的字面量
+var literals = map[string]bool{
+	"true": true, "false": true, "null": true, "nil": true, "None": true, "True": true, "False": true, "undefined": true,
+}
+
+// syntaxes 支持语法高亮的语言
+var syntaxes = []*syntax{
+	{name: "go", ext: ".go", aliases: []string{"golang"}, quotes: "\"'`",
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"},
+		keywords: []string{"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return", "select", "struct", "switch", "type", "var"}},
+	{name: "python", ext: ".py", aliases: []string{"py"}, quotes: "\"'", tripleQuotes: true,
+		lineComments: []string{"#"},
+		keywords:     []string{"and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "nonlocal", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield"}},
+	{name: "javascript", ext: ".js", aliases: []string{"js", "jsx", "mjs", "typescript", "ts", "tsx", "vue"}, quotes: "\"'`",
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"},
+		keywords: []string{"async", "await", "break", "case", "catch", "class", "const", "continue", "default", "delete", "do", "else", "export", "extends", "finally", "for", "from", "function", "if", "import", "in", "instanceof", "interface", "let", "new", "of", "return", "static", "super", "switch", "this", "throw", "try", "type", "typeof", "var", "void", "while", "yield"}},
+	{name: "json", ext: ".json", quotes: "\""},
+	{name: "yaml", ext: ".yaml", aliases: []string{"yml"}, quotes: "\"'",
+		lineComments: []string{"#"}},
+	{name: "toml", ext: ".toml", aliases: []string{"ini", "conf", "cfg", "env"}, quotes: "\"'",
+		lineComments: []string{"#", ";"}},
+	{name: "shell", ext: ".sh", aliases: []string{"sh", "bash", "zsh", "console"}, quotes: "\"'",
+		lineComments: []string{"#"},
+		keywords:     []string{"case", "do", "done", "echo", "elif", "else", "esac", "exit", "export", "fi", "for", "function", "if", "in", "local", "return", "then", "until", "while"}},
+	{name: "sql", ext: ".sql", quotes: "'\"",
+		lineComments: []string{"--"}, blockComment: [2]string{"/*", "*/"},
+		keywords: []string{"ALTER", "AND", "AS", "ASC", "BY", "CREATE", "DELETE", "DESC", "DISTINCT", "DROP", "FROM", "GROUP", "HAVING", "IN", "INDEX", "INNER", "INSERT", "INTO", "IS", "JOIN", "LEFT", "LIKE", "LIMIT", "NOT", "NULL", "ON", "OR", "ORDER", "PRIMARY", "KEY", "SELECT", "SET", "TABLE", "UNION", "UPDATE", "VALUES", "WHERE", "WITH"}},
+	{name: "java", ext: ".java", aliases: []string{"kotlin", "kt"}, quotes: "\"'",
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"},
+		keywords: []string{"abstract", "break", "case", "catch", "class", "continue", "default", "do", "else", "enum", "extends", "final", "finally", "for", "if", "implements", "import", "instanceof", "interface", "new", "package", "private", "protected", "public", "return", "static", "super", "switch", "this", "throw", "throws", "try", "void", "while"}},
+	{name: "c", ext: ".c", aliases: []string{"h", "cpp", "c++", "cc", "hpp", "cxx", "csharp", "cs"}, quotes: "\"'",
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"},
+		keywords: []string{"auto", "break", "case", "char", "class", "const", "continue", "default", "delete", "do", "double", "else", "enum", "extern", "float", "for", "if", "include", "int", "long", "namespace", "new", "private", "public", "return", "short", "signed", "sizeof", "static", "struct", "switch", "template", "typedef", "union", "unsigned", "using", "void", "while"}},
+	{name: "rust", ext: ".rs", aliases: []string{"rs"}, quotes: "\"",
+		lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"},
+		keywords: []string{"as", "async", "await", "break", "const", "continue", "crate", "else", "enum", "extern", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub", "ref", "return", "self", "Self", "static", "struct", "trait", "type", "unsafe", "use", "where", "while"}},
+	{name: "xml", ext: ".xml", aliases: []string{"html", "htm", "svg"}, quotes: "\"'",
+		blockComment: [2]string{"<!--", "-->"}},
+	{name: "diff", ext: ".diff", aliases: []string{"patch"}, lineBased: true},
+	{name: "text", ext: ".txt", aliases: []string{"txt", "log", "plain", "plaintext"}, plain: true},
+}
+
+// findSyntax 根据语言名、别名或扩展名查找语言规则
+func findSyntax(name string) *syntax {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "."))
+	if name == "" {
+		return nil
+	}
+	for _, s := range syntaxes {
+		if s.name == name || strings.TrimPrefix(s.ext, ".") == name {
+			return s
+		}
+		for _, alias := range s.aliases {
+			if alias == name {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// detectSyntax 优先使用指定的语言，其次按文件扩展名推断，都无法识别时按纯文本处理
+func detectSyntax(language, filename string) *syntax {
+	if s := findSyntax(language); s != nil {
+		return s
+	}
+	if s := findSyntax(path.Ext(filename)); s != nil {
+		return s
+	}
+	return findSyntax("text")
+}
+
+// token 高亮记号，class 为空表示普通文本
+type token struct {
+	class string
+	text  string
+}
+
+// tokenize 将文本切分为高亮记号
+// 规则刻意保持简单：只识别注释、字符串、数字、关键字和字面量，足以覆盖日志、配置和常见代码片段
+func (s *syntax) tokenize(src string) []token {
+	if s.plain {
+		return []token{{text: src}}
+	}
+	if s.lineBased {
+		return s.tokenizeLines(src)
+	}
+
+	keywords := make(map[string]bool, len(s.keywords))
+	for _, k := range s.keywords {
+		keywords[k] = true
+	}
+
+	var tokens []token
+	plainStart := 0
+	emit := func(start, end int, class string) {
+		if plainStart < start {
+			tokens = append(tokens, token{text: src[plainStart:start]})
+		}
+		tokens = append(tokens, token{class: class, text: src[start:end]})
+		plainStart = end
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+
+		if end := s.matchComment(src, i); end > i {
+			emit(i, end, "c")
+			i = end
+			continue
+		}
+
+		if strings.IndexByte(s.quotes, c) >= 0 {
+			end := s.matchString(src, i)
+			emit(i, end, "s")
+			i = end
+			continue
+		}
+
+		if isDigit(c) && (i == 0 || !isIdent(src[i-1])) {
+			end := i + 1
+			for end < len(src) && (isIdent(src[end]) || src[end] == '.') {
+				end++
+			}
+			emit(i, end, "n")
+			i = end
+			continue
+		}
+
+		if isIdent(c) && (i == 0 || !isIdent(src[i-1])) {
+			end := i + 1
+			for end < len(src) && isIdent(src[end]) {
+				end++
+			}
+			word := src[i:end]
+			switch {
+			case keywords[word] || (s.name == "sql" && keywords[strings.ToUpper(word)]):
+				emit(i, end, "k")
+			case literals[word]:
+				emit(i, end, "l")
+			}
+			i = end
+			continue
+		}
+
+		i++
+	}
+	if plainStart < len(src) {
+		tokens = append(tokens, token{text: src[plainStart:]})
+	}
+	return tokens
+}
+
+// matchComment 匹配从 i 开始的注释，返回注释结束位置（不是注释时返回 i）
+func (s *syntax) matchComment(src string, i int) int {
+	for _, prefix := range s.lineComments {
+		if strings.HasPrefix(src[i:], prefix) {
+			// shell 中 $# 和 ${#var} 不是注释
+			if prefix == "#" && i > 0 && (src[i-1] == '$' || src[i-1] == '{') {
+				continue
+			}
+			if end := strings.IndexByte(src[i:], '\n'); end >= 0 {
+				return i + end
+			}
+			return len(src)
+		}
+	}
+	if open, close := s.blockComment[0], s.blockComment[1]; open != "" && strings.HasPrefix(src[i:], open) {
+		if end := strings.Index(src[i+len(open):], close); end >= 0 {
+			return i + len(open) + end + len(close)
+		}
+		return len(src)
+	}
+	return i
+}
+
+// matchString 匹配从 i 开始的字符串，返回结束位置
+// 普通字符串在行尾结束（未闭合时不影响后续行），反引号和三引号字符串可以跨行
+func (s *syntax) matchString(src string, i int) int {
+	quote := src[i]
+	if s.tripleQuotes && strings.HasPrefix(src[i:], strings.Repeat(string(quote), 3)) {
+		delim := strings.Repeat(string(quote), 3)
+		if end := strings.Index(src[i+3:], delim); end >= 0 {
+			return i + 3 + end + 3
+		}
+		return len(src)
+	}
+
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			if quote != '`' {
+				j++
+			}
+		case quote:
+			return j + 1
+		case '\n':
+			if quote != '`' {
+				return j
+			}
+		}
+	}
+	return len(src)
+}
+
+// tokenizeLines 按行着色：新增、删除和区块标记
+func (s *syntax) tokenizeLines(src string) []token {
+	var tokens []token
+	for _, line := range strings.SplitAfter(src, "\n") {
+		class := ""
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "@@"):
+			class = "m"
+		case strings.HasPrefix(line, "+"):
+			class = "a"
+		case strings.HasPrefix(line, "-"):
+			class = "d"
+		}
+		tokens = append(tokens, token{class: class, text: line})
+	}
+	return tokens
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
+
+// highlightLines 返回逐行高亮后的 HTML，跨行的记号（块注释、多行字符串）在每一行内单独闭合
+func highlightLines(src string, s *syntax) []template.HTML {
+	src = strings.TrimSuffix(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var lines []template.HTML
+	var line strings.Builder
+	for _, tok := range s.tokenize(src) {
+		pieces := strings.Split(tok.text, "\n")
+		for i, piece := range pieces {
+			if i > 0 {
+				lines = append(lines, template.HTML(line.String()))
+				line.Reset()
+			}
+			if piece == "" {
+				continue
+			}
+			if tok.class == "" {
+				line.WriteString(html.EscapeString(piece))
+			} else {
+				line.WriteString(`<span class="` + tok.class + `">` + html.EscapeString(piece) + `</span>`)
+			}
+		}
+	}
+	return append(lines, template.HTML(line.String()))
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestDetectSyntax(t *testing.T) {
+	tests := []struct {
+		language string
+		filename string
+		want     string
+	}{
+		{language: "go", want: "go"},
+		{language: " Golang ", want: "go"},
+		{language: ".py", want: "python"},
+		{language: "ts", want: "javascript"},
+		{filename: "main.rs", want: "rust"},
+		{filename: "Dockerfile.YML", want: "yaml"},
+		{language: "sql", filename: "query.py", want: "sql"},
+		{language: "brainfuck", filename: "a.py", want: "python"},
+		{language: "brainfuck", filename: "a.unknown", want: "text"},
+		{want: "text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.language+"|"+tt.filename, func(t *testing.T) {
+			if got := detectSyntax(tt.language, tt.filename); got.name != tt.want {
+				t.Fatalf("detectSyntax(%q, %q) = %s, 期望 %s", tt.language, tt.filename, got.name, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlightLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		language string
+		src      string
+		want     []template.HTML
+	}{
+		{
+			name:     "字符串中的标签和实体被转义",
+			language: "go",
+			src:      `s := "<script>&amp;"`,
+			want:     []template.HTML{`s := <span class="s">&#34;&lt;script&gt;&amp;amp;&#34;</span>`},
+		},
+		{
+			name:     "字符串中的转义引号",
+			language: "javascript",
+			src:      `let s = '\'</script>'`,
+			want:     []template.HTML{`<span class="k">let</span> s = <span class="s">&#39;\&#39;&lt;/script&gt;&#39;</span>`},
+		},
+		{
+			name:     "行注释中的标签被转义",
+			language: "go",
+			src:      "// <script>alert(1)</script> & more\nreturn",
+			want: []template.HTML{
+				`<span class="c">// &lt;script&gt;alert(1)&lt;/script&gt; &amp; more</span>`,
+				`<span class="k">return</span>`,
+			},
+		},
+		{
+			name:     "块注释跨行",
+			language: "c",
+			src:      "/* <b>\n& */ int x;",
+			want: []template.HTML{
+				`<span class="c">/* &lt;b&gt;</span>`,
+				`<span class="c">&amp; */</span> <span class="k">int</span> x;`,
+			},
+		},
+		{
+			name:     "HTML 注释中的脚本",
+			language: "html",
+			src:      `<!-- <script>x</script> --><p>`,
+			want:     []template.HTML{`<span class="c">&lt;!-- &lt;script&gt;x&lt;/script&gt; --&gt;</span>&lt;p&gt;`},
+		},
+		{
+			name:     "未闭合的字符串在行尾结束",
+			language: "go",
+			src:      "x := \"<open\nreturn 1",
+			want: []template.HTML{
+				`x := <span class="s">&#34;&lt;open</span>`,
+				`<span class="k">return</span> <span class="n">1</span>`,
+			},
+		},
+		{
+			name:     "未闭合的三引号字符串延续到末尾",
+			language: "python",
+			src:      "s = \"\"\"<doc>\nreturn &",
+			want: []template.HTML{
+				`s = <span class="s">&#34;&#34;&#34;&lt;doc&gt;</span>`,
+				`<span class="s">return &amp;</span>`,
+			},
+		},
+		{
+			name:     "未闭合的块注释延续到末尾",
+			language: "go",
+			src:      "/* <open\nreturn \"x\"",
+			want: []template.HTML{
+				`<span class="c">/* &lt;open</span>`,
+				`<span class="c">return &#34;x&#34;</span>`,
+			},
+		},
+		{
+			name:     "未知语言按纯文本转义",
+			language: "brainfuck",
+			src:      "<script>alert('&')</script>\nif \"x\" // y",
+			want: []template.HTML{
+				`&lt;script&gt;alert(&#39;&amp;&#39;)&lt;/script&gt;`,
+				`if &#34;x&#34; // y`,
+			},
+		},
+		{
+			name:     "diff 按行着色",
+			language: "diff",
+			src:      "--- a\n+++ b\n@@ -1 +1 @@\n-<old>\n+<new>\n ctx\r\n",
+			want: []template.HTML{
+				`<span class="m">--- a</span>`,
+				`<span class="m">+++ b</span>`,
+				`<span class="m">@@ -1 +1 @@</span>`,
+				`<span class="d">-&lt;old&gt;</span>`,
+				`<span class="a">+&lt;new&gt;</span>`,
+				` ctx`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := highlightLines(tt.src, detectSyntax(tt.language, ""))
+			if len(got) != len(tt.want) {
+				t.Fatalf("得到 %d 行, 期望 %d 行: %q", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("第 %d 行 = %q, 期望 %q", i+1, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"r2box/models"
+	"strings"
+)
+
+// directDownloadAgents 命令行下载工具的 User-Agent 前缀，访问短链接时直接下载而不是展示落地页
+var directDownloadAgents = []string{"curl/", "wget/", "aria2/", "httpie/", "powershell/"}
+
+// wantsDirectDownload 是否跳过落地页直接下载：?dl=1 或命令行工具访问
+func wantsDirectDownload(r *http.Request) bool {
+	if r.URL.Query().Get("dl") == "1" {
+		return true
+	}
+	agent := strings.ToLower(r.UserAgent())
+	for _, prefix := range directDownloadAgents {
+		if strings.HasPrefix(agent, prefix) || strings.Contains(agent, " "+prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveLanding 文件短链接落地页：展示文件名、大小、类型、剩余时间和下载按钮，并带有 OpenGraph / Twitter Card 标签
+// 打开落地页不计入下载次数（聊天软件抓取链接预览不会消耗阅后即焚的次数），点击下载后才计数
+func (h *FilesHandler) serveLanding(w http.ResponseWriter, r *http.Request, file *models.File) {
+	if !h.admitView(w, r, file) {
+		return
+	}
+
+	shortURL := requestBaseURL(r) + "/s/" + file.ShortCode
+
+	// 通过 token 解锁的访问，下载链接同样需要携带 token
+	dl := url.Values{"dl": {"1"}}
+	if token := r.URL.Query().Get("token"); token != "" {
+		dl.Set("token", token)
+	}
+
+	page := landingPageData{
+		Filename:    file.Filename,
+		Size:        models.FormatBytes(file.Size),
+		ContentType: file.ContentType,
+		Remaining:   file.TimeRemaining(),
+		ShortURL:    shortURL,
+		DownloadURL: "/s/" + file.ShortCode + "?" + dl.Encode(),
+	}
+	if !file.Pinned {
+		page.ExpiresAt = file.ExpiresAt.Format("2006-01-02 15:04")
+	}
+	if file.MaxDownloads > 0 {
+		page.Limited = true
+		page.DownloadsLeft = file.MaxDownloads - file.DownloadCount
+	}
+	page.PreviewKind, page.PreviewURL = h.previewURL(file)
+	if strings.HasPrefix(page.PreviewURL, "/") {
+		// 自托管存储的签名 URL 为相对路径，OpenGraph 图片需要绝对地址
+		page.PreviewURL = requestBaseURL(r) + page.PreviewURL
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := landingPage.Execute(w, page); err != nil {
+		log.Printf("[Files] 渲染落地页失败: %v", err)
+	}
+}
+
+// landingPageData 落地页数据
+type landingPageData struct {
+	Filename      string
+	Size          string
+	ContentType   string
+	Remaining     string
+	ExpiresAt     string // 为空表示永不过期
+	Limited       bool   // 是否限制下载次数
+	DownloadsLeft int    // 剩余下载次数
+	ShortURL      string
+	DownloadURL   string
+	PreviewKind   string // image / video / audio / pdf，为空表示不预览
+	PreviewURL    string
+}
+
+// landingPage 文件落地页
+var landingPage = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Filename}} - R2Box</title>
+<meta property="og:type" content="website">
+<meta property="og:site_name" content="R2Box">
+<meta property="og:title" content="{{.Filename}}">
+<meta property="og:description" content="{{.Size}} · {{.ContentType}}{{if .ExpiresAt}} · {{.ExpiresAt}} 过期{{end}}">
+<meta property="og:url" content="{{.ShortURL}}">
+{{if eq .PreviewKind "image"}}<meta property="og:image" content="{{.PreviewURL}}">
+<meta name="twitter:card" content="summary_large_image">
+<meta name="twitter:image" content="{{.PreviewURL}}">{{else}}<meta name="twitter:card" content="summary">{{end}}
+<meta name="twitter:title" content="{{.Filename}}">
+<meta name="twitter:description" content="{{.Size}} · {{.ContentType}}{{if .ExpiresAt}} · {{.ExpiresAt}} 过期{{end}}">
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #f5f7fa; display: flex; align-items: center; justify-content: center; min-height: 100vh; margin: 0; padding: 0 16px; }
+main { background: #fff; padding: 32px; border-radius: 16px; box-shadow: 0 4px 24px rgba(0,0,0,.08); width: 100%; max-width: 420px; box-sizing: border-box; margin: 48px 0; }
+main.wide { max-width: 880px; }
+.preview { margin: 0 0 24px; text-align: center; }
+.preview img, .preview video { max-width: 100%; max-height: 70vh; border-radius: 8px; }
+.preview audio { width: 100%; }
+.preview iframe { width: 100%; height: 70vh; border: 1px solid #eee; border-radius: 8px; }
+h1 { font-size: 18px; margin: 0 0 16px; word-break: break-all; }
+dl { display: grid; grid-template-columns: auto 1fr; gap: 8px 16px; font-size: 14px; margin: 0 0 24px; }
+dt { color: #999; }
+dd { margin: 0; word-break: break-all; }
+a.download { display: block; padding: 10px 12px; border-radius: 8px; background: #18a058; color: #fff; text-align: center; text-decoration: none; font-size: 14px; }
+.hint { color: #999; font-size: 12px; margin: 12px 0 0; text-align: center; }
+</style>
+</head>
+<body>
+<main{{if .PreviewKind}}{{if ne .PreviewKind "audio"}} class="wide"{{end}}{{end}}>
+<h1>📄 {{.Filename}}</h1>
+{{if .PreviewKind}}<div class="preview">
+{{- if eq .PreviewKind "image"}}<img src="{{.PreviewURL}}" alt="{{.Filename}}">
+{{- else if eq .PreviewKind "video"}}<video src="{{.PreviewURL}}" controls preload="metadata"></video>
+{{- else if eq .PreviewKind "audio"}}<audio src="{{.PreviewURL}}" controls preload="metadata"></audio>
+{{- else if eq .PreviewKind "pdf"}}<iframe src="{{.PreviewURL}}" title="{{.Filename}}"></iframe>
+{{- end}}</div>{{end}}
+<dl>
+<dt>大小</dt><dd>{{.Size}}</dd>
+<dt>类型</dt><dd>{{.ContentType}}</dd>
+<dt>剩余时间</dt><dd>{{.Remaining}}{{if .ExpiresAt}}（{{.ExpiresAt}} 过期）{{end}}</dd>
+{{if .Limited}}<dt>剩余下载</dt><dd>{{.DownloadsLeft}} 次</dd>{{end}}
+</dl>
+<a class="download" href="{{.DownloadURL}}">下载</a>
+{{if .Limited}}<p class="hint">下载次数用完后文件将被删除</p>{{end}}
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"r2box/models"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxPasteSize 文本片段的大小上限（网页视图逐行渲染，过大的文本应作为文件上传）
+const maxPasteSize = 1 << 20
+
+// pasteContentType 文本片段的存储类型
+const pasteContentType = "text/plain; charset=utf-8"
+
+// PasteRequest 创建文本片段请求（JSON）
+type PasteRequest struct {
+	Content   string      `json:"content"`
+	Filename  string      `json:"filename,omitempty"` // 文件名，缺省为 "paste" 加语言的扩展名
+	Language  string      `json:"language,omitempty"` // 语法高亮的语言，缺省时按文件扩展名推断
+	ExpiresIn expiryValue `json:"expires_in"`
+	ExpiresAt string      `json:"expires_at,omitempty"`
+
+	MaxDownloads int    `json:"max_downloads,omitempty"`
+	Password     string `json:"password,omitempty"`
+	ShortCode    string `json:"short_code,omitempty"`
+}
+
+// CreatePaste 创建文本片段，与文件一样拥有短码和有效期
+// POST /api/pastes
+// 请求体为 JSON（PasteRequest）时读取其中的字段；否则请求体即文本内容，其余参数（filename、language、expires_in、
+// expires_at、max_downloads、short_code）通过查询参数传递，分享密码通过 X-R2Box-Password 请求头设置
+// 返回值与流式上传相同：默认纯文本短链接，Accept: application/json 或 ?format=json 时返回 JSON
+func (h *UploadHandler) CreatePaste(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PasteRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		// JSON 转义最多使内容膨胀为 6 倍
+		if err := json.NewDecoder(io.LimitReader(r.Body, 6*maxPasteSize+4096)).Decode(&req); err != nil {
+			http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+			return
+		}
+	} else {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxPasteSize+1))
+		if err != nil {
+			http.Error(w, `{"error":"读取内容失败"}`, http.StatusBadRequest)
+			return
+		}
+		query := r.URL.Query()
+		maxDownloads, err := parseMaxDownloads(query.Get("max_downloads"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req = PasteRequest{
+			Content:      string(body),
+			Filename:     query.Get("filename"),
+			Language:     query.Get("language"),
+			ExpiresIn:    expiryValue(query.Get("expires_in")),
+			ExpiresAt:    query.Get("expires_at"),
+			MaxDownloads: maxDownloads,
+			Password:     r.Header.Get(passwordHeader),
+			ShortCode:    query.Get("short_code"),
+		}
+	}
+
+	if req.Content == "" {
+		http.Error(w, `{"error":"内容不能为空"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.Content) > maxPasteSize {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("文本超过 %s，请作为文件上传", models.FormatBytes(maxPasteSize)))
+		return
+	}
+	if !utf8.ValidString(req.Content) {
+		http.Error(w, `{"error":"内容必须为 UTF-8 文本"}`, http.StatusBadRequest)
+		return
+	}
+	if req.MaxDownloads < 0 {
+		http.Error(w, `{"error":"max_downloads 不能为负数"}`, http.StatusBadRequest)
+		return
+	}
+
+	filename := path.Base(strings.TrimSpace(req.Filename))
+	if filename == "" || filename == "." || filename == "/" {
+		filename = ""
+	}
+	lang := detectSyntax(req.Language, filename)
+	if filename == "" {
+		filename = "paste" + lang.ext
+	}
+
+	file := &models.File{
+		Filename:     filename,
+		Size:         int64(len(req.Content)),
+		ContentType:  pasteContentType,
+		Kind:         models.KindPaste,
+		Language:     lang.name,
+		MaxDownloads: req.MaxDownloads,
+	}
+	if err := h.expiry.apply(file, string(req.ExpiresIn), req.ExpiresAt); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := applyPassword(file, req.Password); err != nil {
+		http.Error(w, `{"error":"设置密码失败"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := applyShortCode(file, req.ShortCode); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !h.streamFile(w, file, strings.NewReader(req.Content), file.Size) {
+		return
+	}
+
+	log.Printf("[Paste] 文本片段已创建: file_id=%s, language=%s, size=%d", file.ID, file.Language, file.Size)
+	writeStreamResult(w, r, file)
+}
+
+// servePaste 文本片段短链接：浏览器访问时展示带行号和语法高亮的网页，?raw=1 或非浏览器请求返回原始文本
+// 每次查看计入一次下载，下载次数限制和密码保护与文件相同
+func (h *FilesHandler) servePaste(w http.ResponseWriter, r *http.Request, file *models.File) {
+	if !h.admitDownload(w, r, file) {
+		return
+	}
+	if file.DownloadsExhausted() {
+		h.burn(file)
+	}
+
+	body, err := h.storage.GetObject(file.R2Key)
+	if err != nil {
+		log.Printf("[Paste] 读取文本片段失败: %s, %v", file.R2Key, err)
+		http.Error(w, `{"error":"读取文本失败"}`, http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(body, maxPasteSize+1))
+	if err != nil {
+		log.Printf("[Paste] 读取文本片段失败: %s, %v", file.R2Key, err)
+		http.Error(w, `{"error":"读取文本失败"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	query := r.URL.Query()
+	if query.Get("raw") != "" || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", pasteContentType)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		return
+	}
+
+	// 通过 token 解锁的访问，原始文本链接同样需要携带 token
+	raw := url.Values{"raw": {"1"}}
+	if token := query.Get("token"); token != "" {
+		raw.Set("token", token)
+	}
+	page := pastePageData{
+		Filename: file.Filename,
+		Language: file.Language,
+		Size:     models.FormatBytes(file.Size),
+		RawURL:   "/s/" + file.ShortCode + "?" + raw.Encode(),
+	}
+	if !file.Pinned {
+		page.ExpiresAt = file.ExpiresAt.Format("2006-01-02 15:04")
+	}
+	if file.MaxDownloads > 0 {
+		page.Remaining = file.MaxDownloads - file.DownloadCount
+		page.Limited = true
+	}
+	for i, line := range highlightLines(string(content), detectSyntax(file.Language, file.Filename)) {
+		page.Lines = append(page.Lines, pasteLine{Number: i + 1, HTML: line})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pastePage.Execute(w, page); err != nil {
+		log.Printf("[Paste] 渲染文本页面失败: %v", err)
+	}
+}
+
+// pastePageData 文本片段页面数据
+type pastePageData struct {
+	Filename  string
+	Language  string
+	Size      string
+	RawURL    string
+	ExpiresAt string // 为空表示永不过期
+	Limited   bool   // 是否限制查看次数
+	Remaining int    // 剩余查看次数
+	Lines     []pasteLine
+}
+
+// pasteLine 已高亮的一行
+type pasteLine struct {
+	Number int
+	HTML   template.HTML
+}
+
+// pastePage 文本片段页面（行号可点击定位，复制时不包含行号）
+var pastePage = template.Must(template.New("paste").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Filename}} - R2Box</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #f5f7fa; margin: 0; padding: 24px 16px; }
+main { background: #fff; border-radius: 16px; box-shadow: 0 4px 24px rgba(0,0,0,.08); max-width: 1100px; margin: 0 auto; overflow: hidden; }
+header { display: flex; flex-wrap: wrap; align-items: center; gap: 12px; padding: 16px 20px; border-bottom: 1px solid #eee; font-size: 14px; }
+h1 { font-size: 16px; margin: 0; flex: 1; word-break: break-all; }
+.meta { color: #999; }
+a { color: #18a058; text-decoration: none; }
+.code { overflow-x: auto; }
+table { border-collapse: collapse; font: 13px/1.6 ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; width: 100%; }
+td { padding: 0 12px; vertical-align: top; white-space: pre; }
+td.ln { text-align: right; color: #bbb; user-select: none; width: 1%; border-right: 1px solid #eee; }
+td.ln a { color: inherit; }
+tr:target { background: #fff8c5; }
+.c { color: #6a737d; font-style: italic; } .s { color: #032f62; } .n { color: #005cc5; } .k { color: #d73a49; } .l { color: #005cc5; }
+.a { color: #22863a; background: #f0fff4; } .d { color: #b31d28; background: #ffeef0; } .m { color: #6f42c1; }
+</style>
+</head>
+<body>
+<main>
+<header>
+<h1>{{.Filename}}</h1>
+<span class="meta">{{.Language}} · {{.Size}} · {{len .Lines}} 行 · {{if .ExpiresAt}}有效期至 {{.ExpiresAt}}{{else}}永久有效{{end}}{{if .Limited}} · 剩余查看 {{.Remaining}} 次{{end}}</span>
+{{if not .Limited}}<a href="{{.RawURL}}">原始文本</a>{{end}}
+</header>
+<div class="code"><table><tbody>
+{{range .Lines}}<tr id="L{{.Number}}"><td class="ln"><a href="#L{{.Number}}">{{.Number}}</a></td><td>{{.HTML}}</td></tr>
+{{end}}</tbody></table></div>
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"log"
+	"mime"
+	"r2box/models"
+	"strings"
+)
+
+// previewTypes 允许内联预览的类型及落地页中的展示方式
+// 采用白名单：HTML、SVG、XML 等浏览器会执行脚本的类型一律以附件下载
+var previewTypes = map[string]string{
+	"image/png":       "image",
+	"image/jpeg":      "image",
+	"image/gif":       "image",
+	"image/webp":      "image",
+	"image/avif":      "image",
+	"image/bmp":       "image",
+	"video/mp4":       "video",
+	"video/webm":      "video",
+	"video/ogg":       "video",
+	"audio/mpeg":      "audio",
+	"audio/mp4":       "audio",
+	"audio/aac":       "audio",
+	"audio/ogg":       "audio",
+	"audio/wav":       "audio",
+	"audio/x-wav":     "audio",
+	"audio/webm":      "audio",
+	"audio/flac":      "audio",
+	"application/pdf": "pdf",
+}
+
+// previewKind 返回文件的预览方式（image / video / audio / pdf），不允许预览时返回空字符串
+// 同时返回规范化后的类型，作为预览 URL 的响应类型（去掉参数，避免客户端声明的类型夹带其他内容）
+func previewKind(contentType string) (kind, mediaType string) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", ""
+	}
+	mediaType = strings.ToLower(mediaType)
+	kind, ok := previewTypes[mediaType]
+	if !ok {
+		return "", ""
+	}
+	return kind, mediaType
+}
+
+// previewURL 为允许预览的文件生成内联预览 URL，不允许预览或生成失败时返回空字符串
+// 限制下载次数的文件不提供预览，预览不计数，否则可以绕过阅后即焚
+func (h *FilesHandler) previewURL(file *models.File) (kind, url string) {
+	if file.MaxDownloads > 0 || file.Kind == models.KindPaste {
+		return "", ""
+	}
+	kind, mediaType := previewKind(file.ContentType)
+	if kind == "" {
+		return "", ""
+	}
+	url, err := h.storage.GeneratePreviewURL(file.R2Key, file.Filename, mediaType, file.LinkTTL())
+	if err != nil {
+		log.Printf("[Files] 生成预览 URL 失败: %s, %v", file.R2Key, err)
+		return "", ""
+	}
+	return kind, url
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"r2box/middleware"
+	"r2box/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unlockTokenTTL 解锁令牌（及 Cookie）的有效期
+const unlockTokenTTL = 10 * time.Minute
+
+// unlockCookiePrefix 解锁 Cookie 名前缀，后接文件 ID
+const unlockCookiePrefix = "r2box_unlock_"
+
+// shareSigner 为受密码保护的文件签发和校验解锁令牌
+type shareSigner struct {
+	secret []byte
+}
+
+// sign 签发令牌，格式为 "过期时间戳.签名"
+// 签名覆盖文件 ID、过期时间和密码哈希，修改或取消密码后旧令牌随之失效
+func (s shareSigner) sign(file *models.File, expires time.Time) string {
+	ts := strconv.FormatInt(expires.Unix(), 10)
+	return ts + "." + s.signature(file, ts)
+}
+
+// verify 校验令牌是否属于该文件且未过期
+func (s shareSigner) verify(file *models.File, token string) bool {
+	ts, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.signature(file, ts)))
+}
+
+// signature 计算签名（前缀 "unlock" 与存储签名 URL 区分用途）
+func (s shareSigner) signature(file *models.File, ts string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("unlock\n" + file.ID + "\n" + ts + "\n" + file.PasswordHash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// unlocked 请求是否携带了有效的解锁令牌（?token= 或 Cookie）
+func (h *FilesHandler) unlocked(r *http.Request, file *models.File) bool {
+	if token := r.URL.Query().Get("token"); token != "" && h.share.verify(file, token) {
+		return true
+	}
+	cookie, err := r.Cookie(unlockCookiePrefix + file.ID)
+	return err == nil && h.share.verify(file, cookie.Value)
+}
+
+// UnlockResponse 解锁响应
+type UnlockResponse struct {
+	Token       string `json:"token"`
+	DownloadURL string `json:"download_url"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+// Unlock 校验分享密码，成功后下发短期有效的解锁令牌
+// POST /s/:code/unlock，密码通过 JSON {"password": "..."} 或表单字段 password 提交
+// 表单提交成功后写入 Cookie 并重定向回短链接，JSON 请求返回令牌和带令牌的下载地址
+func (h *FilesHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	shortCode := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/s/"), "/unlock")
+	file, err := models.GetFileByShortCode(h.db, shortCode)
+	if err != nil {
+		http.Error(w, `{"error":"文件不存在"}`, http.StatusNotFound)
+		return
+	}
+
+	// 已不可下载的文件不再校验密码和签发令牌
+	if file.UploadStatus == "missing" {
+		http.Error(w, `{"error":"文件对象已丢失"}`, http.StatusNotFound)
+		return
+	}
+	if fileGone(file) {
+		writeGone(w)
+		return
+	}
+
+	isJSON := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	var password string
+	if isJSON {
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+			return
+		}
+		password = req.Password
+	} else {
+		password = r.PostFormValue("password")
+	}
+
+	if !file.CheckPassword(password) {
+		// 失败次数计入速率限制，超过上限后该 IP 被暂时锁定
+		middleware.RecordFailedAttempt(h.db, getClientIP(r))
+		log.Printf("[Files] 分享密码错误: file_id=%s", file.ID)
+		if isJSON || wantsJSON(r) {
+			http.Error(w, `{"error":"密码错误"}`, http.StatusUnauthorized)
+			return
+		}
+		renderUnlockPage(w, file, "密码错误，请重试", http.StatusUnauthorized)
+		return
+	}
+
+	expires := time.Now().Add(unlockTokenTTL)
+	token := h.share.sign(file, expires)
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookiePrefix + file.ID,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(unlockTokenTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if isJSON || wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(UnlockResponse{
+			Token:       token,
+			DownloadURL: "/s/" + file.ShortCode + "?dl=1&token=" + token,
+			ExpiresAt:   expires.Format(time.RFC3339),
+		})
+		return
+	}
+
+	http.Redirect(w, r, "/s/"+file.ShortCode, http.StatusSeeOther)
+}
+
+// requireUnlock 文件需要密码：浏览器访问时展示解锁页面，API 请求返回 401
+func requireUnlock(w http.ResponseWriter, r *http.Request, file *models.File) {
+	if wantsJSON(r) || strings.HasPrefix(r.URL.Path, "/api/") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":      "该文件需要密码",
+			"unlock_url": "/s/" + file.ShortCode + "/unlock",
+		})
+		return
+	}
+	renderUnlockPage(w, file, "", http.StatusUnauthorized)
+}
+
+// SetPasswordRequest 设置分享密码请求（为空表示取消密码）
+type SetPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// SetPassword 设置或取消文件的分享密码
+// PUT /api/files/:id/password
+func (h *FilesHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 从 URL 路径中提取文件 ID
+	// /api/files/:id/password
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 5 {
+		http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req SetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+		return
+	}
+
+	file, err := models.GetFileByID(h.db, parts[3])
+	if err != nil {
+		http.Error(w, `{"error":"文件不存在"}`, http.StatusNotFound)
+		return
+	}
+
+	if err := file.SetPassword(h.db, req.Password); err != nil {
+		log.Printf("[Files] 设置分享密码失败: %v", err)
+		http.Error(w, `{"error":"设置密码失败"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[Files] 分享密码已更新: file_id=%s, protected=%v", file.ID, file.HasPassword)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"has_password": file.HasPassword,
+	})
+}
+
+// applyPassword 上传时设置分享密码
+func applyPassword(file *models.File, password string) error {
+	if password == "" {
+		return nil
+	}
+	hash, err := models.HashSharePassword(password)
+	if err != nil {
+		return err
+	}
+	file.PasswordHash = hash
+	file.HasPassword = true
+	return nil
+}
+
+// unlockPage 解锁页面
+var unlockPage = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Filename}} - 需要密码 - R2Box</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #f5f7fa; display: flex; align-items: center; justify-content: center; min-height: 100vh; margin: 0; }
+form { background: #fff; padding: 32px; border-radius: 16px; box-shadow: 0 4px 24px rgba(0,0,0,.08); width: 320px; }
+h1 { font-size: 18px; margin: 0 0 8px; word-break: break-all; }
+p { color: #666; font-size: 14px; margin: 0 0 16px; }
+.error { color: #d03050; }
+input, button { box-sizing: border-box; width: 100%; padding: 10px 12px; font-size: 14px; border-radius: 8px; }
+input { border: 1px solid #ddd; margin-bottom: 12px; }
+button { border: 0; background: #18a058; color: #fff; cursor: pointer; }
+</style>
+</head>
+<body>
+<form method="post" action="/s/{{.ShortCode}}/unlock">
+<h1>🔒 {{.Filename}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{else}}<p>该文件受密码保护，请输入密码后查看</p>{{end}}
+<input type="password" name="password" placeholder="密码" autofocus required>
+<button type="submit">解锁</button>
+</form>
+</body>
+</html>
+`))
+
+// renderUnlockPage 渲染解锁页面
+func renderUnlockPage(w http.ResponseWriter, file *models.File, message string, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	unlockPage.Execute(w, map[string]string{
+		"Filename":  file.Filename,
+		"ShortCode": file.ShortCode,
+		"Error":     message,
+	})
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"r2box/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareSignerVerify(t *testing.T) {
+	signer := shareSigner{secret: []byte("secret")}
+	file := &models.File{ID: "file-1", PasswordHash: "hash-1"}
+
+	tests := []struct {
+		name  string
+		token func() string
+		file  *models.File
+		want  bool
+	}{
+		{
+			name:  "有效",
+			token: func() string { return signer.sign(file, time.Now().Add(unlockTokenTTL)) },
+			file:  file,
+			want:  true,
+		},
+		{
+			name:  "已过期",
+			token: func() string { return signer.sign(file, time.Now().Add(-time.Second)) },
+			file:  file,
+		},
+		{
+			name:  "其他文件",
+			token: func() string { return signer.sign(file, time.Now().Add(unlockTokenTTL)) },
+			file:  &models.File{ID: "file-2", PasswordHash: "hash-1"},
+		},
+		{
+			name:  "修改密码后失效",
+			token: func() string { return signer.sign(file, time.Now().Add(unlockTokenTTL)) },
+			file:  &models.File{ID: "file-1", PasswordHash: "hash-2"},
+		},
+		{
+			name: "延长过期时间",
+			token: func() string {
+				token := signer.sign(file, time.Now().Add(unlockTokenTTL))
+				_, sig, _ := strings.Cut(token, ".")
+				return "99999999999." + sig
+			},
+			file: file,
+		},
+		{
+			name: "其他密钥签发",
+			token: func() string {
+				return shareSigner{secret: []byte("other")}.sign(file, time.Now().Add(unlockTokenTTL))
+			},
+			file: file,
+		},
+		{name: "格式错误", token: func() string { return "garbage" }, file: file},
+		{name: "空令牌", token: func() string { return "" }, file: file},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signer.verify(tt.file, tt.token()); got != tt.want {
+				t.Fatalf("verify() = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSharePassword(t *testing.T) {
+	hash, err := models.HashSharePassword("s3cret")
+	if err != nil {
+		t.Fatalf("生成密码哈希失败: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$2") {
+		t.Fatalf("密码哈希 %q 不是 bcrypt 格式", hash)
+	}
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{name: "未设置密码", hash: "", password: "", want: true},
+		{name: "bcrypt 正确", hash: hash, password: "s3cret", want: true},
+		{name: "bcrypt 错误", hash: hash, password: "wrong"},
+		{name: "bcrypt 空密码", hash: hash, password: ""},
+		{name: "无效哈希", hash: "invalid", password: "s3cret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &models.File{PasswordHash: tt.hash}
+			if got := file.CheckPassword(tt.password); got != tt.want {
+				t.Fatalf("CheckPassword(%q) = %v, 期望 %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
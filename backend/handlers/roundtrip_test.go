@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"r2box/config"
+	"r2box/database"
+	"r2box/models"
+	"r2box/services"
+	"strings"
+	"testing"
+)
+
+// newMemoryHandlers 使用临时数据库和内存存储创建上传和文件处理器
+func newMemoryHandlers(t *testing.T) (*UploadHandler, *FilesHandler, *services.MemoryStorage) {
+	t.Helper()
+	if err := database.Init(filepath.Join(t.TempDir(), "r2box.db")); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	storage := services.NewMemoryStorage([]byte("storage-secret"))
+	cfg := config.Load()
+	return NewUploadHandler(database.DB, storage, cfg), NewFilesHandler(database.DB, storage, []byte("share-secret")), storage
+}
+
+// postJSON 调用处理器并解析 JSON 响应
+func postJSON(t *testing.T, handler http.HandlerFunc, path string, body any, out any) int {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("编码请求失败: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if out != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("解析 %s 响应失败: %v, body=%s", path, err, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+// download 经由计数的下载接口获取文件，返回状态码和下载到的内容
+func download(t *testing.T, files *FilesHandler, storage *services.MemoryStorage, fileID string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	files.GetDownloadURL(rec, httptest.NewRequest(http.MethodGet, "/api/files/"+fileID+"/download", nil))
+	if rec.Code != http.StatusFound {
+		return rec.Code, ""
+	}
+
+	rec2 := httptest.NewRecorder()
+	storage.ServeHTTP(rec2, httptest.NewRequest(http.MethodGet, rec.Header().Get("Location"), nil))
+	if rec2.Code != http.StatusOK {
+		t.Fatalf("读取下载直链失败: %d %s", rec2.Code, rec2.Body.String())
+	}
+	body, _ := io.ReadAll(rec2.Body)
+	return rec.Code, string(body)
+}
+
+func TestMemoryRoundTrip(t *testing.T) {
+	upload, files, storage := newMemoryHandlers(t)
+	const content = "hello, r2box"
+
+	var presign PresignResponse
+	code := postJSON(t, upload.GeneratePresignURL, "/api/upload/presign", PresignRequest{
+		Filename:     "hello.txt",
+		ContentType:  "text/plain",
+		Size:         int64(len(content)),
+		MaxDownloads: 2,
+	}, &presign)
+	if code != http.StatusOK {
+		t.Fatalf("预签名失败: %d", code)
+	}
+
+	// 上传内容与声明大小不符时拒绝
+	rec := httptest.NewRecorder()
+	storage.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, presign.UploadURL, strings.NewReader(content+"!")))
+	if rec.Code == http.StatusOK {
+		t.Fatal("超过声明大小的上传不应成功")
+	}
+
+	put := httptest.NewRequest(http.MethodPut, presign.UploadURL, strings.NewReader(content))
+	put.Header.Set("Content-Type", "text/plain")
+	rec = httptest.NewRecorder()
+	storage.ServeHTTP(rec, put)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("上传失败: %d %s", rec.Code, rec.Body.String())
+	}
+
+	var confirm ConfirmResponse
+	if code := postJSON(t, upload.ConfirmUpload, "/api/upload/confirm", ConfirmRequest{FileID: presign.FileID}, &confirm); code != http.StatusOK {
+		t.Fatalf("确认上传失败: %d", code)
+	}
+	if want := "/api/files/" + presign.FileID + "/download"; confirm.DownloadURL != want {
+		t.Fatalf("download_url = %q, 期望计数的下载接口 %q", confirm.DownloadURL, want)
+	}
+
+	steps := []struct {
+		name       string
+		wantCode   int
+		wantStatus string
+	}{
+		{name: "第一次下载", wantCode: http.StatusFound, wantStatus: "completed"},
+		{name: "最后一次下载", wantCode: http.StatusFound, wantStatus: "burned"},
+		{name: "次数用完", wantCode: http.StatusGone, wantStatus: "burned"},
+	}
+	for _, step := range steps {
+		code, body := download(t, files, storage, presign.FileID)
+		if code != step.wantCode {
+			t.Fatalf("%s: 状态码 %d, 期望 %d", step.name, code, step.wantCode)
+		}
+		if code == http.StatusFound && body != content {
+			t.Fatalf("%s: 内容 %q, 期望 %q", step.name, body, content)
+		}
+
+		file, err := models.GetFileByID(database.DB, presign.FileID)
+		if err != nil {
+			t.Fatalf("%s: 读取文件记录失败: %v", step.name, err)
+		}
+		if file.UploadStatus != step.wantStatus {
+			t.Fatalf("%s: 文件状态 %q, 期望 %q", step.name, file.UploadStatus, step.wantStatus)
+		}
+	}
+}
+
+func TestPresignRejectsInvalidSize(t *testing.T) {
+	upload, _, _ := newMemoryHandlers(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		handler  http.HandlerFunc
+		size     int64
+		wantCode int
+	}{
+		{name: "预签名: 空文件", path: "/api/upload/presign", handler: upload.GeneratePresignURL, size: 0, wantCode: http.StatusBadRequest},
+		{name: "预签名: 负数", path: "/api/upload/presign", handler: upload.GeneratePresignURL, size: -1, wantCode: http.StatusBadRequest},
+		{name: "预签名: 正常", path: "/api/upload/presign", handler: upload.GeneratePresignURL, size: 1, wantCode: http.StatusOK},
+		{name: "分片初始化: 空文件", path: "/api/upload/multipart/init", handler: upload.InitiateMultipartUpload, size: 0, wantCode: http.StatusBadRequest},
+		{name: "分片初始化: 负数", path: "/api/upload/multipart/init", handler: upload.InitiateMultipartUpload, size: -1, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := postJSON(t, tt.handler, tt.path, map[string]any{"filename": "a.bin", "size": tt.size}, nil)
+			if code != tt.wantCode {
+				t.Fatalf("状态码 %d, 期望 %d", code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -11,13 +11,15 @@ import (
 // SetupHandler R2 配置向导处理器
 type SetupHandler struct {
 	db              *sql.DB
+	storageBackend  string
 	onConfigChanged func() // 配置变更回调
 }
 
 // NewSetupHandler 创建配置向导处理器
-func NewSetupHandler(db *sql.DB, onConfigChanged func()) *SetupHandler {
+func NewSetupHandler(db *sql.DB, storageBackend string, onConfigChanged func()) *SetupHandler {
 	return &SetupHandler{
 		db:              db,
+		storageBackend:  storageBackend,
 		onConfigChanged: onConfigChanged,
 	}
 }
@@ -25,6 +27,7 @@ func NewSetupHandler(db *sql.DB, onConfigChanged func()) *SetupHandler {
 // StatusResponse 配置状态响应
 type StatusResponse struct {
 	Configured bool                   `json:"configured"`
+	Backend    string                 `json:"backend"`
 	Config     map[string]interface{} `json:"config,omitempty"`
 }
 
@@ -37,6 +40,16 @@ func (h *SetupHandler) Status(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("[Setup] 获取 R2 配置状态")
 
+	// 非 R2 后端无需配置向导
+	if h.storageBackend != services.BackendR2 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(StatusResponse{
+			Configured: true,
+			Backend:    h.storageBackend,
+		})
+		return
+	}
+
 	var r2Configured string
 	err := h.db.QueryRow("SELECT value FROM system_config WHERE key = 'r2_configured'").Scan(&r2Configured)
 
@@ -44,6 +57,7 @@ func (h *SetupHandler) Status(w http.ResponseWriter, r *http.Request) {
 
 	response := StatusResponse{
 		Configured: configured,
+		Backend:    h.storageBackend,
 	}
 
 	// 如果已配置，返回配置信息（隐藏敏感信息）
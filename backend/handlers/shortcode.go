@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"r2box/models"
+	"strings"
+)
+
+// applyShortCode 上传时指定自定义短码，为空时由系统随机生成
+func applyShortCode(file *models.File, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil
+	}
+	if err := models.ValidateShortCode(code); err != nil {
+		return err
+	}
+	file.ShortCode = code
+	return nil
+}
+
+// writeShortCodeTaken 短码已被占用时返回 409 和可用的替代短码
+func writeShortCodeTaken(w http.ResponseWriter, err *models.ShortCodeTakenError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":       err.Error(),
+		"suggestions": err.Suggestions,
+	})
+}
+
+// ShortCodeCheckResponse 短码可用性检查响应
+type ShortCodeCheckResponse struct {
+	ShortCode   string   `json:"short_code"`
+	Available   bool     `json:"available"`
+	Error       string   `json:"error,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// CheckShortCode 检查自定义短码是否可用，不可用时给出替代建议
+// GET /api/short-codes/:code
+func (h *FilesHandler) CheckShortCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	code := strings.TrimPrefix(r.URL.Path, "/api/short-codes/")
+	resp := ShortCodeCheckResponse{ShortCode: code}
+
+	if err := models.ValidateShortCode(code); err != nil {
+		resp.Error = err.Error()
+	} else {
+		available, err := models.ShortCodeAvailable(h.db, code)
+		if err != nil {
+			http.Error(w, `{"error":"检查短码失败"}`, http.StatusInternalServerError)
+			return
+		}
+		resp.Available = available
+		if !available {
+			resp.Error = "短码已被占用"
+			resp.Suggestions = models.SuggestShortCodes(h.db, code, 3)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// SetShortCodeRequest 修改短码请求
+type SetShortCodeRequest struct {
+	ShortCode string `json:"short_code"`
+}
+
+// SetShortCode 修改文件的短码（自定义别名），旧短链接随之失效
+// PUT /api/files/:id/short-code
+func (h *FilesHandler) SetShortCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 从 URL 路径中提取文件 ID
+	// /api/files/:id/short-code
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) < 5 {
+		http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req SetShortCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+		return
+	}
+	code := strings.TrimSpace(req.ShortCode)
+	if err := models.ValidateShortCode(code); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	file, err := models.GetFileByID(h.db, parts[3])
+	if err != nil {
+		http.Error(w, `{"error":"文件不存在"}`, http.StatusNotFound)
+		return
+	}
+
+	if err := file.SetShortCode(h.db, code); err != nil {
+		var taken *models.ShortCodeTakenError
+		if errors.As(err, &taken) {
+			writeShortCodeTaken(w, taken)
+			return
+		}
+		log.Printf("[Files] 修改短码失败: %v", err)
+		http.Error(w, `{"error":"修改短码失败"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[Files] 短码已修改: file_id=%s, short_code=%s", file.ID, file.ShortCode)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"short_code": file.ShortCode,
+		"short_url":  "/s/" + file.ShortCode,
+	})
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"r2box/models"
+	"r2box/services"
+	"strings"
+	"time"
+)
+
+// passwordHeader 命令行上传时设置分享密码的请求头
+const passwordHeader = "X-R2Box-Password"
+
+// StreamUploadResponse 流式上传响应
+type StreamUploadResponse struct {
+	FileID    string `json:"file_id"`
+	Filename  string `json:"filename"`
+	Size      int64  `json:"size"`
+	ShortURL  string `json:"short_url"`
+	ExpiresAt string `json:"expires_at"`
+	Pinned    bool   `json:"pinned,omitempty"` // 永不过期
+}
+
+// StreamUpload 经由服务端中转的上传（适用于 curl 和脚本，无需预签名三步流程）
+// PUT  /api/upload/stream/{filename}  请求体即文件内容
+// POST /api/upload/stream             multipart/form-data，读取第一个文件字段
+// 查询参数 expires_in 指定有效期（如 12h、14d）或 expires_at 指定过期时间，expires_in=never 表示永不过期；max_downloads 限制下载次数；short_code 指定自定义短码；
+// 分享密码通过 X-R2Box-Password 请求头（或表单字段 password）设置，避免出现在 URL 中；默认返回纯文本短链接，Accept: application/json 或 ?format=json 时返回 JSON
+func (h *UploadHandler) StreamUpload(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		h.streamPut(w, r)
+	case http.MethodPost:
+		h.streamForm(w, r)
+	default:
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+	}
+}
+
+// streamPut 处理请求体为文件内容的上传
+func (h *UploadHandler) streamPut(w http.ResponseWriter, r *http.Request) {
+	filename := path.Base(strings.TrimPrefix(r.URL.Path, "/api/upload/stream"))
+	if filename == "" || filename == "." || filename == "/" {
+		http.Error(w, `{"error":"缺少文件名"}`, http.StatusBadRequest)
+		return
+	}
+
+	file := &models.File{
+		Filename:    filename,
+		Size:        r.ContentLength,
+		ContentType: detectContentType(filename, r.Header.Get("Content-Type")),
+	}
+
+	query := r.URL.Query()
+	if err := h.expiry.apply(file, query.Get("expires_in"), query.Get("expires_at")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	maxDownloads, err := parseMaxDownloads(query.Get("max_downloads"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	file.MaxDownloads = maxDownloads
+	if err := applyPassword(file, r.Header.Get(passwordHeader)); err != nil {
+		http.Error(w, `{"error":"设置密码失败"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := applyShortCode(file, query.Get("short_code")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 长度未知（chunked）时最多接收单文件上限
+	if !h.streamFile(w, file, r.Body, h.maxFileSize) {
+		return
+	}
+	writeStreamResult(w, r, file)
+}
+
+// streamForm 处理 multipart/form-data 上传
+func (h *UploadHandler) streamForm(w http.ResponseWriter, r *http.Request) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, `{"error":"请求必须为 multipart/form-data"}`, http.StatusBadRequest)
+		return
+	}
+
+	fields := map[string]string{
+		"expires_in":    r.URL.Query().Get("expires_in"),
+		"expires_at":    r.URL.Query().Get("expires_at"),
+		"max_downloads": r.URL.Query().Get("max_downloads"),
+		"password":      r.Header.Get(passwordHeader),
+		"short_code":    r.URL.Query().Get("short_code"),
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			http.Error(w, `{"error":"缺少文件字段"}`, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, `{"error":"无效的表单数据"}`, http.StatusBadRequest)
+			return
+		}
+
+		// 文件字段之前的 expires_in / expires_at / max_downloads / password / short_code 表单字段同样生效
+		if part.FileName() == "" {
+			if value, ok := fields[part.FormName()]; ok && value == "" {
+				data, _ := io.ReadAll(io.LimitReader(part, 64))
+				fields[part.FormName()] = string(data)
+			}
+			part.Close()
+			continue
+		}
+
+		file := &models.File{
+			Filename:    path.Base(part.FileName()),
+			Size:        -1,
+			ContentType: detectContentType(part.FileName(), part.Header.Get("Content-Type")),
+		}
+
+		if err := h.expiry.apply(file, fields["expires_in"], fields["expires_at"]); err != nil {
+			part.Close()
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		maxDownloads, err := parseMaxDownloads(fields["max_downloads"])
+		if err != nil {
+			part.Close()
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		file.MaxDownloads = maxDownloads
+		if err := applyPassword(file, fields["password"]); err != nil {
+			part.Close()
+			http.Error(w, `{"error":"设置密码失败"}`, http.StatusInternalServerError)
+			return
+		}
+		if err := applyShortCode(file, fields["short_code"]); err != nil {
+			part.Close()
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// 文件大小未知，以整个请求体的长度作为上限
+		limit := h.maxFileSize
+		if r.ContentLength > 0 && r.ContentLength < limit {
+			limit = r.ContentLength
+		}
+
+		ok := h.streamFile(w, file, part, limit)
+		part.Close()
+		if ok {
+			writeStreamResult(w, r, file)
+		}
+		return
+	}
+}
+
+// streamFile 创建文件记录并将 body 写入存储，成功后文件状态为 completed
+// file.Size < 0 表示长度未知，此时最多接收 limit 字节，配额随已接收的数据逐步预留（不会一开始就按上限占用配额）
+// 失败时已写入错误响应并清理记录，返回 false
+func (h *UploadHandler) streamFile(w http.ResponseWriter, file *models.File, body io.Reader, limit int64) bool {
+	known := file.Size >= 0
+	if known {
+		limit = file.Size
+	} else {
+		file.Size = 0
+	}
+	if limit > h.maxFileSize {
+		http.Error(w, `{"error":"文件大小超过限制"}`, http.StatusRequestEntityTooLarge)
+		return false
+	}
+
+	layout, err := h.partSizer.Plan(limit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	file.UploadStatus = "pending"
+	if err := file.CreateWithQuota(h.db, h.totalStorage); err != nil {
+		writeCreateError(w, err)
+		return false
+	}
+
+	log.Printf("[Upload] 流式上传: file_id=%s, filename=%s, size=%d", file.ID, file.Filename, file.Size)
+
+	var reserve services.ReserveFunc
+	if !known {
+		reserve = func(size int64) error {
+			return file.GrowReservation(h.db, h.totalStorage, size)
+		}
+	}
+
+	written, err := services.StreamUpload(h.storage, file.R2Key, file.ContentType, body, layout.PartSize, limit, reserve)
+	if err != nil {
+		log.Printf("[Upload] 流式上传失败: file_id=%s, %v", file.ID, err)
+		models.DeleteFile(h.db, file.ID)
+		if errors.Is(err, services.ErrBodyTooLarge) {
+			http.Error(w, `{"error":"文件大小超过限制"}`, http.StatusRequestEntityTooLarge)
+			return false
+		}
+		var quotaErr *models.QuotaError
+		if errors.As(err, &quotaErr) {
+			writeCreateError(w, err)
+			return false
+		}
+		http.Error(w, `{"error":"上传失败"}`, http.StatusInternalServerError)
+		return false
+	}
+
+	if !known && written != file.Size {
+		if err := file.UpdateSize(h.db, written); err != nil {
+			log.Printf("[Upload] 更新文件大小失败: %v", err)
+		}
+	}
+
+	// 校验写入的对象与记录一致（请求体提前结束等情况会在这里被拒绝）
+	if status, err := h.verifyUploadedObject(file); err != nil {
+		log.Printf("[Upload] 上传校验失败: file_id=%s, %v", file.ID, err)
+		writeError(w, status, err.Error())
+		return false
+	}
+
+	file.UpdateStatusWithReason(h.db, "completed", file.StatusReason)
+	return true
+}
+
+// writeStreamResult 返回上传结果：默认纯文本短链接，客户端要求时返回 JSON
+func writeStreamResult(w http.ResponseWriter, r *http.Request, file *models.File) {
+	shortURL := requestBaseURL(r) + "/s/" + file.ShortCode
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(StreamUploadResponse{
+			FileID:    file.ID,
+			Filename:  file.Filename,
+			Size:      file.Size,
+			ShortURL:  shortURL,
+			ExpiresAt: file.ExpiresAt.Format(time.RFC3339),
+			Pinned:    file.Pinned,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, shortURL+"\n")
+}
+
+// detectContentType 优先使用客户端声明的类型，缺省或为表单编码时按扩展名推断
+func detectContentType(filename, declared string) string {
+	if declared != "" && !strings.HasPrefix(declared, "application/x-www-form-urlencoded") {
+		return declared
+	}
+	if byExt := mime.TypeByExtension(path.Ext(filename)); byExt != "" {
+		return byExt
+	}
+	return "application/octet-stream"
+}
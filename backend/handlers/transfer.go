@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"r2box/models"
+	"r2box/services"
+	"strconv"
+	"strings"
+)
+
+// TransferUpload transfer.sh 兼容上传：PUT /{filename}
+// 支持 transfer.sh 的 Max-Days（有效天数，受过期时间策略限制）和 Max-Downloads（下载次数限制）请求头，X-R2Box-Password 设置分享密码，查询参数 short_code 指定自定义短码
+// 与 transfer.sh 一样返回纯文本下载链接 /{short_code}/{filename}，例如: curl --upload-file ./x.tar.gz https://host/x.tar.gz
+func (h *UploadHandler) TransferUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if name == "" || strings.Contains(name, "/") || name == "." || name == ".." {
+		http.Error(w, `{"error":"无效的文件名"}`, http.StatusBadRequest)
+		return
+	}
+
+	maxDays := r.Header.Get("Max-Days")
+	if maxDays != "" {
+		if days, err := strconv.Atoi(maxDays); err != nil || days < 1 {
+			http.Error(w, `{"error":"无效的 Max-Days"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	maxDownloads := 0
+	if value := r.Header.Get("Max-Downloads"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, `{"error":"无效的 Max-Downloads"}`, http.StatusBadRequest)
+			return
+		}
+		maxDownloads = n
+	}
+
+	file := &models.File{
+		Filename:     path.Base(name),
+		Size:         r.ContentLength,
+		ContentType:  detectContentType(name, r.Header.Get("Content-Type")),
+		MaxDownloads: maxDownloads,
+	}
+	if err := h.expiry.apply(file, maxDays, ""); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := applyPassword(file, r.Header.Get(passwordHeader)); err != nil {
+		http.Error(w, `{"error":"设置密码失败"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := applyShortCode(file, r.URL.Query().Get("short_code")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	log.Printf("[Upload] transfer.sh 上传: filename=%s, lifetime=%s, max_downloads=%d", file.Filename, file.Lifetime, maxDownloads)
+
+	if !h.streamFile(w, file, r.Body, h.maxFileSize) {
+		return
+	}
+	if wantsJSON(r) {
+		writeStreamResult(w, r, file)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, requestBaseURL(r)+transferPath(file)+"\n")
+}
+
+// transferPath transfer.sh 风格的下载路径 /{short_code}/{filename}
+func transferPath(file *models.File) string {
+	return "/" + file.ShortCode + "/" + url.PathEscape(file.Filename)
+}
+
+// TransferDownload transfer.sh 兼容下载：GET /{short_code}/{filename}，即 TransferUpload 返回的链接
+// 与下载接口一样计数并检查密码，但由 r2box 直接返回文件内容，curl 无需 -L 即可下载；HEAD 请求只返回文件信息，不计数
+// 路径不是 /{short_code}/{filename} 形式或文件名不匹配时返回 false 且不写入响应，由调用方继续处理（前端静态文件）
+func (h *FilesHandler) TransferDownload(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	code, name, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok || code == "" || name == "" || strings.Contains(name, "/") {
+		return false
+	}
+	file, err := models.GetFileByShortCode(h.db, code)
+	if err != nil || file.Kind != models.KindFile || file.Filename != name {
+		return false
+	}
+
+	if r.Method == http.MethodHead {
+		if h.admitView(w, r, file) {
+			setTransferHeaders(w, file)
+		}
+		return true
+	}
+
+	// 先打开对象再计数，对象丢失时不消耗下载次数
+	body, err := h.storage.GetObject(file.R2Key)
+	if errors.Is(err, services.ErrObjectNotFound) {
+		http.Error(w, `{"error":"文件对象已丢失"}`, http.StatusNotFound)
+		return true
+	}
+	if err != nil {
+		log.Printf("[Files] 读取对象失败: %s, %v", file.R2Key, err)
+		http.Error(w, `{"error":"读取文件失败"}`, http.StatusInternalServerError)
+		return true
+	}
+	defer body.Close()
+
+	if !h.admitDownload(w, r, file) {
+		return true
+	}
+	// 下载次数用完的文件在传输完成后才开始删除倒计时
+	if file.DownloadsExhausted() {
+		defer h.burn(file)
+	}
+
+	setTransferHeaders(w, file)
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("[Files] 下载中断: %s, %v", file.Filename, err)
+	}
+	return true
+}
+
+// setTransferHeaders 直接返回文件内容时的响应头：始终作为附件下载，并禁止浏览器嗅探和执行内容
+func setTransferHeaders(w http.ResponseWriter, file *models.File) {
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}))
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", "no-store")
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"r2box/database"
+	"r2box/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTransferDownload(t *testing.T) {
+	_, files, storage := newMemoryHandlers(t)
+
+	file := &models.File{Filename: "x y.tar.gz", Size: 5, ContentType: "application/gzip", UploadStatus: "completed", MaxDownloads: 2, Lifetime: time.Hour}
+	if err := file.Create(database.DB); err != nil {
+		t.Fatalf("创建文件记录失败: %v", err)
+	}
+	if _, err := storage.PutObject(file.R2Key, file.ContentType, strings.NewReader("hello"), file.Size); err != nil {
+		t.Fatalf("写入对象失败: %v", err)
+	}
+	link := transferPath(file)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		wantHandled bool
+		wantCode    int
+		wantBody    string
+		wantCount   int
+	}{
+		{name: "HEAD 不计数", method: http.MethodHead, path: link, wantHandled: true, wantCode: http.StatusOK},
+		{name: "下载", method: http.MethodGet, path: link, wantHandled: true, wantCode: http.StatusOK, wantBody: "hello", wantCount: 1},
+		{name: "文件名不匹配", method: http.MethodGet, path: "/" + file.ShortCode + "/other.tar.gz", wantCount: 1},
+		{name: "短码不存在", method: http.MethodGet, path: "/nope123/x.tar.gz", wantCount: 1},
+		{name: "前端静态文件", method: http.MethodGet, path: "/assets/index.js", wantCount: 1},
+		{name: "只有一段路径", method: http.MethodGet, path: "/" + file.ShortCode, wantCount: 1},
+		{name: "最后一次下载", method: http.MethodGet, path: link, wantHandled: true, wantCode: http.StatusOK, wantBody: "hello", wantCount: 2},
+		{name: "次数用完", method: http.MethodGet, path: link, wantHandled: true, wantCode: http.StatusGone, wantCount: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handled := files.TransferDownload(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if handled != tt.wantHandled {
+				t.Fatalf("TransferDownload(%s) = %v, 期望 %v", tt.path, handled, tt.wantHandled)
+			}
+			if handled && rec.Code != tt.wantCode {
+				t.Fatalf("状态码 %d, 期望 %d", rec.Code, tt.wantCode)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Fatalf("内容 %q, 期望 %q", rec.Body.String(), tt.wantBody)
+			}
+			if tt.wantCode == http.StatusOK && rec.Header().Get("Content-Disposition") == "" {
+				t.Fatal("缺少 Content-Disposition")
+			}
+
+			f, err := models.GetFileByID(database.DB, file.ID)
+			if err != nil {
+				t.Fatalf("读取文件记录失败: %v", err)
+			}
+			if f.DownloadCount != tt.wantCount {
+				t.Fatalf("download_count = %d, 期望 %d", f.DownloadCount, tt.wantCount)
+			}
+		})
+	}
+}
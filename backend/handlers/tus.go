@@ -0,0 +1,497 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"path"
+	"r2box/config"
+	"r2box/models"
+	"r2box/services"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tus 协议常量
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+	tusPathPrefix = "/api/tus/"
+)
+
+// tusLocks 同一上传的 PATCH/DELETE 请求串行执行
+// 锁按引用计数管理，没有请求持有或等待时即删除，被清理任务终止或过期的上传不会残留
+var tusLocks = struct {
+	sync.Mutex
+	m map[string]*tusLock
+}{m: make(map[string]*tusLock)}
+
+// tusLock 单个上传的锁，refs 为持有和等待该锁的请求数
+type tusLock struct {
+	sync.Mutex
+	refs int
+}
+
+// TusHandler tus 1.0 可续传上传（core + creation、termination、expiration 扩展）
+// 客户端按任意大小分块 PATCH，数据在服务端缓冲攒满一个分片后上传为存储的分片
+type TusHandler struct {
+	*UploadHandler
+	buffer   *services.ChunkBuffer
+	staleAge time.Duration
+}
+
+// NewTusHandler 创建 tus 处理器
+func NewTusHandler(db *sql.DB, storage services.Storage, cfg *config.Config, buffer *services.ChunkBuffer) *TusHandler {
+	return &TusHandler{
+		UploadHandler: NewUploadHandler(db, storage, cfg),
+		buffer:        buffer,
+		staleAge:      cfg.StaleUploadAge,
+	}
+}
+
+// ServeHTTP 处理 /api/tus/ 请求
+func (h *TusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Method == http.MethodOptions {
+		h.options(w)
+		return
+	}
+
+	// 除 OPTIONS 外的请求必须声明协议版本
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "不支持的 tus 版本", http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(tusPathPrefix, "/")), "/")
+	if id == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "方法不允许", http.StatusMethodNotAllowed)
+			return
+		}
+		h.create(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		h.head(w, id)
+	case http.MethodPatch:
+		h.patch(w, r, id)
+	case http.MethodDelete:
+		h.terminate(w, id)
+	default:
+		http.Error(w, "方法不允许", http.StatusMethodNotAllowed)
+	}
+}
+
+// options 返回服务端支持的协议版本和扩展
+func (h *TusHandler) options(w http.ResponseWriter) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.maxFileSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// create 创建上传（creation 扩展）
+// Upload-Metadata 支持 filename/name、filetype/type、expires_in、expires_at、max_downloads、password 和 short_code
+func (h *TusHandler) create(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "缺少或无效的 Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if length > h.maxFileSize {
+		http.Error(w, "文件大小超过限制", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	layout, err := h.partSizer.Plan(length)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	meta := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	filename := path.Base(firstNonEmpty(meta["filename"], meta["name"], "upload"))
+	file := &models.File{
+		Filename:     filename,
+		Size:         length,
+		ContentType:  detectContentType(filename, firstNonEmpty(meta["filetype"], meta["type"])),
+		UploadStatus: "pending",
+	}
+	if err := h.expiry.apply(file, meta["expires_in"], meta["expires_at"]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if file.MaxDownloads, err = parseMaxDownloads(meta["max_downloads"]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := applyPassword(file, meta["password"]); err != nil {
+		http.Error(w, "设置密码失败", http.StatusInternalServerError)
+		return
+	}
+	if err := applyShortCode(file, meta["short_code"]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := file.CreateWithQuota(h.db, h.totalStorage); err != nil {
+		writeCreateError(w, err)
+		return
+	}
+
+	// 空文件无法使用分片上传，直接写入
+	if length == 0 {
+		if _, err := h.storage.PutObject(file.R2Key, file.ContentType, strings.NewReader(""), 0); err != nil {
+			log.Printf("[Tus] 写入空文件失败: %v", err)
+			models.DeleteFile(h.db, file.ID)
+			http.Error(w, "创建上传失败", http.StatusInternalServerError)
+			return
+		}
+		if status, err := h.verifyUploadedObject(file); err != nil {
+			log.Printf("[Tus] 上传校验失败: file_id=%s, %v", file.ID, err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+		file.UpdateStatusWithReason(h.db, "completed", file.StatusReason)
+	} else {
+		uploadID, err := h.storage.InitiateMultipartUpload(file.R2Key, file.ContentType)
+		if err != nil {
+			log.Printf("[Tus] 初始化分片上传失败: %v", err)
+			models.DeleteFile(h.db, file.ID)
+			http.Error(w, "创建上传失败", http.StatusInternalServerError)
+			return
+		}
+		if err := file.SaveMultipartState(h.db, uploadID, layout.PartSize, layout.TotalParts); err != nil {
+			log.Printf("[Tus] 保存分片上传状态失败: %v", err)
+			h.storage.AbortMultipartUpload(file.R2Key, uploadID)
+			models.DeleteFile(h.db, file.ID)
+			http.Error(w, "创建上传失败", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	log.Printf("[Tus] 创建上传: file_id=%s, filename=%s, size=%d, part_size=%d", file.ID, file.Filename, length, layout.PartSize)
+
+	w.Header().Set("Location", tusPathPrefix+file.ID)
+	w.Header().Set("Upload-Expires", h.expiresAt(file).Format(http.TimeFormat))
+	w.Header().Set("X-R2Box-Short-URL", requestBaseURL(r)+"/s/"+file.ShortCode)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// head 返回当前上传偏移量
+func (h *TusHandler) head(w http.ResponseWriter, id string) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	file, offset, ok := h.load(w, id)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(file.Size, 10))
+	if file.UploadStatus != "completed" {
+		w.Header().Set("Upload-Expires", h.expiresAt(file).Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// patch 在指定偏移量追加数据，攒满一个分片即上传，全部到齐后完成上传
+func (h *TusHandler) patch(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type 必须为 application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	requestOffset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || requestOffset < 0 {
+		http.Error(w, "缺少或无效的 Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	unlock := lockTusUpload(id)
+	defer unlock()
+
+	file, offset, ok := h.load(w, id)
+	if !ok {
+		return
+	}
+	if file.UploadStatus != "uploading" {
+		http.Error(w, "上传已完成", http.StatusForbidden)
+		return
+	}
+	if requestOffset != offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		http.Error(w, "Upload-Offset 与服务端不一致", http.StatusConflict)
+		return
+	}
+	if r.ContentLength > file.Size-offset {
+		http.Error(w, "数据超出 Upload-Length", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	parts, err := file.GetParts(h.db)
+	if err != nil {
+		log.Printf("[Tus] 读取分片记录失败: %v", err)
+		http.Error(w, "读取上传状态失败", http.StatusInternalServerError)
+		return
+	}
+	buffered, err := h.buffer.Size(file.ID)
+	if err != nil {
+		log.Printf("[Tus] 读取缓冲区失败: %v", err)
+		http.Error(w, "读取上传状态失败", http.StatusInternalServerError)
+		return
+	}
+
+	// 逐段写入缓冲区，每攒满一个分片就上传（上传失败的分片留在缓冲区，下次请求时重试）
+	for offset < file.Size || buffered == file.PartSize {
+		if buffered == file.PartSize {
+			part, err := h.flush(file, int32(len(parts)+1), buffered)
+			if err != nil {
+				log.Printf("[Tus] 上传分片失败: file_id=%s, %v", file.ID, err)
+				http.Error(w, "上传分片失败", http.StatusInternalServerError)
+				return
+			}
+			parts = append(parts, *part)
+			buffered = 0
+			continue
+		}
+
+		want := file.PartSize - buffered
+		if remaining := file.Size - offset; remaining < want {
+			want = remaining
+		}
+
+		n, copyErr := h.buffer.Append(file.ID, r.Body, want)
+		buffered += n
+		offset += n
+
+		// 请求体已读完或连接中断，已写入的数据会在下次 HEAD 时体现
+		if copyErr != nil || n < want {
+			break
+		}
+	}
+
+	if offset == file.Size {
+		// 最后一个分片可能不足 PartSize
+		if buffered > 0 {
+			part, err := h.flush(file, int32(len(parts)+1), buffered)
+			if err != nil {
+				log.Printf("[Tus] 上传分片失败: file_id=%s, %v", file.ID, err)
+				http.Error(w, "上传分片失败", http.StatusInternalServerError)
+				return
+			}
+			parts = append(parts, *part)
+		}
+
+		if !h.finish(w, file, parts) {
+			return
+		}
+		w.Header().Set("X-R2Box-Short-URL", requestBaseURL(r)+"/s/"+file.ShortCode)
+	} else {
+		w.Header().Set("Upload-Expires", h.expiresAt(file).Format(http.TimeFormat))
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// terminate 终止上传并删除已上传的数据（termination 扩展）
+func (h *TusHandler) terminate(w http.ResponseWriter, id string) {
+	unlock := lockTusUpload(id)
+	defer unlock()
+
+	file, _, ok := h.load(w, id)
+	if !ok {
+		return
+	}
+
+	if file.UploadStatus == "completed" {
+		http.Error(w, "上传已完成，请通过文件管理删除", http.StatusForbidden)
+		return
+	}
+
+	if err := h.storage.AbortMultipartUpload(file.R2Key, file.UploadID); err != nil {
+		log.Printf("[Tus] 终止分片上传失败: %v", err)
+	}
+	h.buffer.Reset(file.ID)
+	if err := models.DeleteFile(h.db, file.ID); err != nil {
+		log.Printf("[Tus] 删除文件记录失败: %v", err)
+		http.Error(w, "终止上传失败", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[Tus] 已终止上传: file_id=%s", file.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// load 获取 tus 上传及其当前偏移量（已提交分片 + 缓冲区）
+// 已完成的上传偏移量等于文件大小；失败时已写入错误响应
+func (h *TusHandler) load(w http.ResponseWriter, id string) (*models.File, int64, bool) {
+	file, err := models.GetFileByID(h.db, id)
+	if err != nil {
+		http.Error(w, "上传不存在", http.StatusNotFound)
+		return nil, 0, false
+	}
+
+	switch file.UploadStatus {
+	case "completed":
+		return file, file.Size, true
+	case "uploading":
+		if file.UploadID == "" {
+			http.Error(w, "上传不存在", http.StatusNotFound)
+			return nil, 0, false
+		}
+	default:
+		// 已取消、被清理或校验失败的上传
+		http.Error(w, "上传已失效", http.StatusGone)
+		return nil, 0, false
+	}
+
+	if time.Now().After(h.expiresAt(file)) {
+		http.Error(w, "上传已过期", http.StatusGone)
+		return nil, 0, false
+	}
+
+	parts, err := file.GetParts(h.db)
+	if err != nil {
+		log.Printf("[Tus] 读取分片记录失败: %v", err)
+		http.Error(w, "读取上传状态失败", http.StatusInternalServerError)
+		return nil, 0, false
+	}
+	buffered, err := h.buffer.Size(file.ID)
+	if err != nil {
+		log.Printf("[Tus] 读取缓冲区失败: %v", err)
+		http.Error(w, "读取上传状态失败", http.StatusInternalServerError)
+		return nil, 0, false
+	}
+
+	var offset int64
+	for _, p := range parts {
+		offset += p.Size
+	}
+	return file, offset + buffered, true
+}
+
+// flush 将缓冲区作为一个分片上传并记录
+func (h *TusHandler) flush(file *models.File, partNumber int32, size int64) (*models.FilePart, error) {
+	f, err := h.buffer.Open(file.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	etag, err := h.storage.UploadPart(file.R2Key, file.UploadID, partNumber, f, size)
+	if err != nil {
+		return nil, err
+	}
+
+	part := models.FilePart{PartNumber: partNumber, ETag: etag, Size: size}
+	if err := file.SavePart(h.db, part); err != nil {
+		return nil, err
+	}
+	if err := h.buffer.Reset(file.ID); err != nil {
+		return nil, err
+	}
+	return &part, nil
+}
+
+// finish 合并全部分片并校验，成功后文件状态为 completed；失败时已写入错误响应
+func (h *TusHandler) finish(w http.ResponseWriter, file *models.File, parts []models.FilePart) bool {
+	completeParts := make([]services.Part, len(parts))
+	for i, p := range parts {
+		completeParts[i] = services.Part{PartNumber: p.PartNumber, ETag: p.ETag, Size: p.Size}
+	}
+
+	if err := h.storage.CompleteMultipartUpload(file.R2Key, file.UploadID, completeParts); err != nil {
+		log.Printf("[Tus] 完成分片上传失败: file_id=%s, %v", file.ID, err)
+		http.Error(w, "完成上传失败", http.StatusInternalServerError)
+		return false
+	}
+	file.ClearParts(h.db)
+
+	if status, err := h.verifyUploadedObject(file); err != nil {
+		log.Printf("[Tus] 上传校验失败: file_id=%s, %v", file.ID, err)
+		http.Error(w, err.Error(), status)
+		return false
+	}
+
+	file.UpdateStatusWithReason(h.db, "completed", file.StatusReason)
+
+	log.Printf("[Tus] 上传完成: file_id=%s, size=%d, parts=%d", file.ID, file.Size, len(parts))
+	return true
+}
+
+// expiresAt 未完成的上传在最近一次活动（提交分片或写入缓冲区）后经过清理任务的保留期失效（expiration 扩展）
+func (h *TusHandler) expiresAt(file *models.File) time.Time {
+	last, err := file.LastActivity(h.db)
+	if err != nil {
+		log.Printf("[Tus] 读取分片记录失败: %v", err)
+	}
+	if modTime, err := h.buffer.ModTime(file.ID); err == nil && modTime.After(last) {
+		last = modTime
+	}
+	return last.Add(h.staleAge)
+}
+
+// lockTusUpload 获取上传锁，返回解锁函数
+func lockTusUpload(id string) func() {
+	tusLocks.Lock()
+	l, ok := tusLocks.m[id]
+	if !ok {
+		l = &tusLock{}
+		tusLocks.m[id] = l
+	}
+	l.refs++
+	tusLocks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		tusLocks.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(tusLocks.m, id)
+		}
+		tusLocks.Unlock()
+	}
+}
+
+// parseTusMetadata 解析 Upload-Metadata（逗号分隔的 "key base64值" 列表）
+func parseTusMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 {
+			continue
+		}
+		value := ""
+		if len(fields) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+		meta[fields[0]] = value
+	}
+	return meta
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
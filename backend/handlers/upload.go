@@ -3,37 +3,56 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"mime"
 	"net/http"
+	"r2box/config"
 	"r2box/models"
 	"r2box/services"
+	"strconv"
+	"strings"
 	"time"
-
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // UploadHandler 上传处理器
 type UploadHandler struct {
-	db          *sql.DB
-	r2Service   *services.R2Service
-	maxFileSize int64
+	db           *sql.DB
+	storage      services.Storage
+	maxFileSize  int64
+	totalStorage int64
+	partSizer    services.PartSizer
+	expiry       expiryPolicy
 }
 
 // NewUploadHandler 创建上传处理器
-func NewUploadHandler(db *sql.DB, r2Service *services.R2Service, maxFileSize int64) *UploadHandler {
+func NewUploadHandler(db *sql.DB, storage services.Storage, cfg *config.Config) *UploadHandler {
 	return &UploadHandler{
-		db:          db,
-		r2Service:   r2Service,
-		maxFileSize: maxFileSize,
+		db:           db,
+		storage:      storage,
+		maxFileSize:  cfg.MaxFileSize,
+		totalStorage: cfg.TotalStorage,
+		partSizer: services.PartSizer{
+			MinPartSize: cfg.MultipartMinPartSize,
+			MaxPartSize: cfg.MultipartMaxPartSize,
+			TargetParts: cfg.MultipartTargetParts,
+		},
+		expiry: newExpiryPolicy(cfg),
 	}
 }
 
 // PresignRequest 预签名请求
 type PresignRequest struct {
-	Filename    string `json:"filename"`
-	ContentType string `json:"content_type"`
-	Size        int64  `json:"size"`
-	ExpiresIn   int    `json:"expires_in"` // 过期天数: 1, 3, 7, 30
+	Filename    string      `json:"filename"`
+	ContentType string      `json:"content_type"`
+	Size        int64       `json:"size"`
+	ExpiresIn   expiryValue `json:"expires_in"`           // 有效期，如 "90m"、"12h"、"14d"，纯数字表示天数，"never" 表示永不过期
+	ExpiresAt   string      `json:"expires_at,omitempty"` // 绝对过期时间（RFC3339），与 expires_in 二选一
+
+	MaxDownloads int    `json:"max_downloads,omitempty"` // 最大下载次数，0 表示不限制，用完后文件被删除
+	Password     string `json:"password,omitempty"`      // 分享密码，为空表示无需密码
+	ShortCode    string `json:"short_code,omitempty"`    // 自定义短码，为空时随机生成
 }
 
 // PresignResponse 预签名响应
@@ -45,6 +64,30 @@ type PresignResponse struct {
 	ExpiresAt   string `json:"expires_at"`
 }
 
+// UploadOptionsResponse 上传选项
+type UploadOptionsResponse struct {
+	MaxFileSize int64         `json:"max_file_size"`
+	Expiry      ExpiryOptions `json:"expiry"`
+}
+
+// GetUploadOptions 获取上传选项（单文件大小上限和过期时间策略）
+// GET /api/upload/options
+func (h *UploadHandler) GetUploadOptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UploadOptionsResponse{
+		MaxFileSize: h.maxFileSize,
+		Expiry:      h.expiry.options(),
+	})
+}
+
+// emptyFileError 预签名和分片上传不接受空文件
+const emptyFileError = "无效的文件大小: 空文件请使用 /api/upload/stream 上传"
+
 // GeneratePresignURL 生成预签名上传 URL（小文件）
 func (h *UploadHandler) GeneratePresignURL(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -58,15 +101,19 @@ func (h *UploadHandler) GeneratePresignURL(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// 验证文件大小
+	// 验证文件大小：content-length 只有在大于 0 时才会签入 URL，声明为 0 的上传不受大小约束，空文件需经由服务端中转上传
+	if req.Size <= 0 {
+		writeError(w, http.StatusBadRequest, emptyFileError)
+		return
+	}
 	if req.Size > h.maxFileSize {
 		http.Error(w, `{"error":"文件大小超过限制"}`, http.StatusBadRequest)
 		return
 	}
 
-	// 验证过期时间（支持30秒测试：-30表示30秒）
-	if req.ExpiresIn != -30 && req.ExpiresIn != 1 && req.ExpiresIn != 3 && req.ExpiresIn != 7 && req.ExpiresIn != 30 {
-		req.ExpiresIn = 7 // 默认 7 天
+	if req.MaxDownloads < 0 {
+		http.Error(w, `{"error":"无效的最大下载次数"}`, http.StatusBadRequest)
+		return
 	}
 
 	// 创建文件记录
@@ -74,18 +121,35 @@ func (h *UploadHandler) GeneratePresignURL(w http.ResponseWriter, r *http.Reques
 		Filename:     req.Filename,
 		Size:         req.Size,
 		ContentType:  req.ContentType,
-		ExpiresIn:    req.ExpiresIn,
+		MaxDownloads: req.MaxDownloads,
 		UploadStatus: "pending",
 	}
+	if err := applyPassword(file, req.Password); err != nil {
+		http.Error(w, `{"error":"设置密码失败"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := applyShortCode(file, req.ShortCode); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	if err := file.Create(h.db); err != nil {
-		http.Error(w, `{"error":"创建文件记录失败"}`, http.StatusInternalServerError)
+	// 验证过期时间
+	if err := h.expiry.apply(file, string(req.ExpiresIn), req.ExpiresAt); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := file.CreateWithQuota(h.db, h.totalStorage); err != nil {
+		writeCreateError(w, err)
 		return
 	}
 
 	// 生成预签名上传 URL
-	uploadURL, err := h.r2Service.GenerateUploadURL(file.R2Key, req.ContentType, time.Hour)
+	uploadURL, err := h.storage.GenerateUploadURL(file.R2Key, req.ContentType, file.Size, time.Hour)
 	if err != nil {
+		// 删除刚创建的记录，释放预留的配额
+		log.Printf("[Upload] 生成上传 URL 失败: file_id=%s, %v", file.ID, err)
+		models.DeleteFile(h.db, file.ID)
 		http.Error(w, `{"error":"生成上传 URL 失败"}`, http.StatusInternalServerError)
 		return
 	}
@@ -94,7 +158,7 @@ func (h *UploadHandler) GeneratePresignURL(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(PresignResponse{
 		FileID:      file.ID,
 		UploadURL:   uploadURL,
-		DownloadURL: "/api/files/" + file.ID + "/download",
+		DownloadURL: countedDownloadURL(file),
 		ShortURL:    "/s/" + file.ShortCode,
 		ExpiresAt:   file.ExpiresAt.Format(time.RFC3339),
 	})
@@ -133,40 +197,49 @@ func (h *UploadHandler) ConfirmUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 更新文件状态
-	file.UpdateStatus(h.db, "completed")
+	// 已被拒绝或取消的上传不能再确认
+	if file.UploadStatus != "pending" && file.UploadStatus != "completed" {
+		writeError(w, http.StatusConflict, "上传状态无效: "+file.UploadStatus+" "+file.StatusReason)
+		return
+	}
 
-	// 生成 R2 预签名下载直链（有效期与文件过期时间一致）
-	downloadURL, err := h.r2Service.GenerateDownloadURL(file.R2Key, file.Filename, time.Until(file.ExpiresAt))
-	if err != nil {
-		log.Printf("[Upload] 生成下载 URL 失败: %v", err)
-		// 即使生成失败也返回成功，使用备用链接
-		downloadURL = "/api/files/" + file.ID + "/download"
+	// 校验对象确实已上传且大小一致
+	if status, err := h.verifyUploadedObject(file); err != nil {
+		log.Printf("[Upload] 上传校验失败: file_id=%s, %v", file.ID, err)
+		writeError(w, status, err.Error())
+		return
 	}
 
+	// 更新文件状态
+	file.UpdateStatusWithReason(h.db, "completed", file.StatusReason)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ConfirmResponse{
 		Success:     true,
 		Message:     "上传确认成功",
-		DownloadURL: downloadURL,
+		DownloadURL: countedDownloadURL(file),
 		ShortURL:    "/s/" + file.ShortCode,
 	})
 }
 
 // MultipartInitRequest 分片上传初始化请求
 type MultipartInitRequest struct {
-	Filename    string `json:"filename"`
-	ContentType string `json:"content_type"`
-	Size        int64  `json:"size"`
-	ExpiresIn   int    `json:"expires_in"`
+	Filename    string      `json:"filename"`
+	ContentType string      `json:"content_type"`
+	Size        int64       `json:"size"`
+	ExpiresIn   expiryValue `json:"expires_in"`
+	ExpiresAt   string      `json:"expires_at,omitempty"`
+
+	MaxDownloads int    `json:"max_downloads,omitempty"`
+	Password     string `json:"password,omitempty"`
+	ShortCode    string `json:"short_code,omitempty"`
 }
 
 // MultipartInitResponse 分片上传初始化响应
 type MultipartInitResponse struct {
-	FileID     string `json:"file_id"`
-	UploadID   string `json:"upload_id"`
-	PartSize   int64  `json:"part_size"`
-	TotalParts int    `json:"total_parts"`
+	FileID   string `json:"file_id"`
+	UploadID string `json:"upload_id"`
+	services.PartLayout
 }
 
 // InitiateMultipartUpload 初始化分片上传
@@ -182,15 +255,26 @@ func (h *UploadHandler) InitiateMultipartUpload(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	// 验证文件大小
+	// 验证文件大小：大小为 0 时分片数为 0，分片上传永远无法完成
+	if req.Size <= 0 {
+		writeError(w, http.StatusBadRequest, emptyFileError)
+		return
+	}
 	if req.Size > h.maxFileSize {
 		http.Error(w, `{"error":"文件大小超过限制"}`, http.StatusBadRequest)
 		return
 	}
 
-	// 验证过期时间（支持30秒测试：-30表示30秒）
-	if req.ExpiresIn != -30 && req.ExpiresIn != 1 && req.ExpiresIn != 3 && req.ExpiresIn != 7 && req.ExpiresIn != 30 {
-		req.ExpiresIn = 7
+	// 根据文件大小计算分片布局
+	layout, err := h.partSizer.Plan(req.Size)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.MaxDownloads < 0 {
+		http.Error(w, `{"error":"无效的最大下载次数"}`, http.StatusBadRequest)
+		return
 	}
 
 	// 创建文件记录
@@ -198,35 +282,55 @@ func (h *UploadHandler) InitiateMultipartUpload(w http.ResponseWriter, r *http.R
 		Filename:     req.Filename,
 		Size:         req.Size,
 		ContentType:  req.ContentType,
-		ExpiresIn:    req.ExpiresIn,
+		MaxDownloads: req.MaxDownloads,
 		UploadStatus: "pending",
 	}
+	if err := applyPassword(file, req.Password); err != nil {
+		http.Error(w, `{"error":"设置密码失败"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := applyShortCode(file, req.ShortCode); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 验证过期时间
+	if err := h.expiry.apply(file, string(req.ExpiresIn), req.ExpiresAt); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	if err := file.Create(h.db); err != nil {
-		http.Error(w, `{"error":"创建文件记录失败"}`, http.StatusInternalServerError)
+	if err := file.CreateWithQuota(h.db, h.totalStorage); err != nil {
+		writeCreateError(w, err)
 		return
 	}
 
 	// 初始化分片上传
-	uploadID, err := h.r2Service.InitiateMultipartUpload(file.R2Key, req.ContentType)
+	uploadID, err := h.storage.InitiateMultipartUpload(file.R2Key, req.ContentType)
 	if err != nil {
+		// 删除刚创建的记录，释放预留的配额
+		log.Printf("[Upload] 初始化分片上传失败: file_id=%s, %v", file.ID, err)
+		models.DeleteFile(h.db, file.ID)
 		http.Error(w, `{"error":"初始化分片上传失败"}`, http.StatusInternalServerError)
 		return
 	}
 
-	// 计算分片信息
-	partSize := int64(20 * 1024 * 1024) // 20MB
-	totalParts := int((req.Size + partSize - 1) / partSize)
+	log.Printf("[Upload] 分片布局: file=%s, size=%d, part_size=%d, total_parts=%d", file.ID, req.Size, layout.PartSize, layout.TotalParts)
 
-	// 保存 uploadID 到数据库
-	h.db.Exec("UPDATE files SET upload_status = 'uploading' WHERE id = ?", file.ID)
+	// 保存 uploadID 和分片信息到数据库，用于断点续传
+	if err := file.SaveMultipartState(h.db, uploadID, layout.PartSize, layout.TotalParts); err != nil {
+		log.Printf("[Upload] 保存分片上传状态失败: %v", err)
+		h.storage.AbortMultipartUpload(file.R2Key, uploadID)
+		models.DeleteFile(h.db, file.ID)
+		http.Error(w, `{"error":"保存分片上传状态失败"}`, http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(MultipartInitResponse{
 		FileID:     file.ID,
 		UploadID:   uploadID,
-		PartSize:   partSize,
-		TotalParts: totalParts,
+		PartLayout: *layout,
 	})
 }
 
@@ -241,6 +345,51 @@ type MultipartPresignRequest struct {
 type MultipartPresignResponse struct {
 	UploadURL  string `json:"upload_url"`
 	PartNumber int32  `json:"part_number"`
+	Size       int64  `json:"size"`
+}
+
+// maxPresignBatch 单次批量预签名最多返回的分片数
+const maxPresignBatch = 1000
+
+// MultipartPresignBatchRequest 批量分片预签名请求
+// 指定 part_numbers 时按列表签名，否则签名 [start_part, end_part] 区间（end_part 缺省为最后一个分片）
+type MultipartPresignBatchRequest struct {
+	FileID      string  `json:"file_id"`
+	UploadID    string  `json:"upload_id"`
+	PartNumbers []int32 `json:"part_numbers,omitempty"`
+	StartPart   int32   `json:"start_part,omitempty"`
+	EndPart     int32   `json:"end_part,omitempty"`
+}
+
+// MultipartPresignBatchResponse 批量分片预签名响应
+type MultipartPresignBatchResponse struct {
+	FileID     string                     `json:"file_id"`
+	UploadID   string                     `json:"upload_id"`
+	TotalParts int                        `json:"total_parts"`
+	Parts      []MultipartPresignResponse `json:"parts"`
+}
+
+// loadMultipartFile 获取进行中的分片上传文件记录，并校验 upload_id 属于该文件
+// 校验失败时已写入错误响应，返回 nil
+func (h *UploadHandler) loadMultipartFile(w http.ResponseWriter, fileID, uploadID string) *models.File {
+	file, err := models.GetFileByID(h.db, fileID)
+	if err != nil {
+		http.Error(w, `{"error":"文件不存在"}`, http.StatusNotFound)
+		return nil
+	}
+
+	if file.UploadStatus != "uploading" || file.UploadID == "" {
+		http.Error(w, `{"error":"该文件没有进行中的分片上传"}`, http.StatusConflict)
+		return nil
+	}
+
+	if uploadID != file.UploadID {
+		log.Printf("[Upload] upload_id 不匹配: file_id=%s, upload_id=%s", file.ID, uploadID)
+		http.Error(w, `{"error":"upload_id 与文件不匹配"}`, http.StatusBadRequest)
+		return nil
+	}
+
+	return file
 }
 
 // GenerateMultipartPresignURL 生成分片预签名 URL
@@ -257,14 +406,20 @@ func (h *UploadHandler) GenerateMultipartPresignURL(w http.ResponseWriter, r *ht
 	}
 
 	// 获取文件记录
-	file, err := models.GetFileByID(h.db, req.FileID)
-	if err != nil {
-		http.Error(w, `{"error":"文件不存在"}`, http.StatusNotFound)
+	file := h.loadMultipartFile(w, req.FileID, req.UploadID)
+	if file == nil {
+		return
+	}
+
+	// 分片大小由初始化时的分片布局决定，并签入 URL
+	partLength := file.PartLength(req.PartNumber)
+	if partLength < 0 {
+		http.Error(w, `{"error":"分片编号超出范围"}`, http.StatusBadRequest)
 		return
 	}
 
 	// 生成分片预签名 URL
-	uploadURL, err := h.r2Service.GenerateMultipartUploadURL(file.R2Key, req.UploadID, req.PartNumber)
+	uploadURL, err := h.storage.GenerateMultipartUploadURL(file.R2Key, file.UploadID, req.PartNumber, partLength)
 	if err != nil {
 		http.Error(w, `{"error":"生成分片上传 URL 失败"}`, http.StatusInternalServerError)
 		return
@@ -274,6 +429,90 @@ func (h *UploadHandler) GenerateMultipartPresignURL(w http.ResponseWriter, r *ht
 	json.NewEncoder(w).Encode(MultipartPresignResponse{
 		UploadURL:  uploadURL,
 		PartNumber: req.PartNumber,
+		Size:       partLength,
+	})
+}
+
+// GenerateMultipartPresignBatch 批量生成分片预签名 URL，减少大文件上传时的请求次数
+// POST /api/upload/multipart/presign-batch
+func (h *UploadHandler) GenerateMultipartPresignBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MultipartPresignBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+		return
+	}
+
+	file := h.loadMultipartFile(w, req.FileID, req.UploadID)
+	if file == nil {
+		return
+	}
+
+	// 确定需要签名的分片编号
+	partNumbers := req.PartNumbers
+	if len(partNumbers) == 0 {
+		start, end := req.StartPart, req.EndPart
+		if start == 0 {
+			start = 1
+		}
+		if end == 0 {
+			end = int32(file.TotalParts)
+		}
+		if start < 1 || end < start || int(end) > file.TotalParts {
+			http.Error(w, `{"error":"分片编号超出范围"}`, http.StatusBadRequest)
+			return
+		}
+		if int(end-start)+1 > maxPresignBatch {
+			end = start + maxPresignBatch - 1
+		}
+		for n := start; n <= end; n++ {
+			partNumbers = append(partNumbers, n)
+		}
+	}
+
+	if len(partNumbers) > maxPresignBatch {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("单次最多预签名 %d 个分片", maxPresignBatch))
+		return
+	}
+
+	parts := make([]MultipartPresignResponse, 0, len(partNumbers))
+	seen := make(map[int32]bool, len(partNumbers))
+	for _, partNumber := range partNumbers {
+		if seen[partNumber] {
+			continue
+		}
+		seen[partNumber] = true
+
+		partLength := file.PartLength(partNumber)
+		if partLength < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("分片编号超出范围: %d", partNumber))
+			return
+		}
+
+		uploadURL, err := h.storage.GenerateMultipartUploadURL(file.R2Key, file.UploadID, partNumber, partLength)
+		if err != nil {
+			log.Printf("[Upload] 生成分片上传 URL 失败: part=%d, %v", partNumber, err)
+			http.Error(w, `{"error":"生成分片上传 URL 失败"}`, http.StatusInternalServerError)
+			return
+		}
+
+		parts = append(parts, MultipartPresignResponse{
+			UploadURL:  uploadURL,
+			PartNumber: partNumber,
+			Size:       partLength,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MultipartPresignBatchResponse{
+		FileID:     file.ID,
+		UploadID:   file.UploadID,
+		TotalParts: file.TotalParts,
+		Parts:      parts,
 	})
 }
 
@@ -287,6 +526,14 @@ type MultipartCompleteRequest struct {
 	} `json:"parts"`
 }
 
+// MultipartIncompleteResponse 分片不完整或校验失败时的响应
+type MultipartIncompleteResponse struct {
+	Error           string  `json:"error"`
+	TotalParts      int     `json:"total_parts"`
+	MissingParts    []int32 `json:"missing_parts"`
+	MismatchedParts []int32 `json:"mismatched_parts"`
+}
+
 // MultipartCompleteResponse 完成分片上传响应
 type MultipartCompleteResponse struct {
 	FileID      string `json:"file_id"`
@@ -321,55 +568,97 @@ func (h *UploadHandler) CompleteMultipartUpload(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if len(req.Parts) == 0 {
+		http.Error(w, `{"error":"缺少分片列表"}`, http.StatusBadRequest)
+		return
+	}
 
 	// 获取文件记录
-	file, err := models.GetFileByID(h.db, req.FileID)
-	if err != nil {
-		http.Error(w, `{"error":"文件不存在"}`, http.StatusNotFound)
+	file := h.loadMultipartFile(w, req.FileID, req.UploadID)
+	if file == nil {
 		return
 	}
 
-	// 获取 R2 中实际存在的分片并完成上传
-	r2Parts, err := h.r2Service.ListParts(file.R2Key, req.UploadID)
+	// 客户端上报的分片
+	reported := make(map[int32]string, len(req.Parts))
+	for _, p := range req.Parts {
+		if p.PartNumber < 1 || int(p.PartNumber) > file.TotalParts {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("分片编号超出范围: %d", p.PartNumber))
+			return
+		}
+		if _, ok := reported[p.PartNumber]; ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("分片编号重复: %d", p.PartNumber))
+			return
+		}
+		reported[p.PartNumber] = p.ETag
+	}
+
+	// 获取存储中实际存在的分片
+	storageParts, err := h.storage.ListParts(file.R2Key, file.UploadID)
 	if err != nil {
 		log.Printf("[Upload] 列出分片失败: %v", err)
 		http.Error(w, `{"error":"列出分片失败"}`, http.StatusInternalServerError)
 		return
 	}
+	stored := make(map[int32]services.Part, len(storageParts))
+	for _, p := range storageParts {
+		stored[p.PartNumber] = p
+	}
+
+	// 按初始化时的分片布局逐个核对：分片必须同时存在于存储和客户端列表中，且 ETag 和大小一致
+	completeParts := make([]services.Part, 0, file.TotalParts)
+	missing := []int32{}
+	mismatched := []int32{}
+	for n := int32(1); n <= int32(file.TotalParts); n++ {
+		part, inStorage := stored[n]
+		etag, inReport := reported[n]
+		switch {
+		case !inStorage || !inReport:
+			missing = append(missing, n)
+		case strings.Trim(etag, `"`) != strings.Trim(part.ETag, `"`) || part.Size != file.PartLength(n):
+			mismatched = append(mismatched, n)
+		default:
+			completeParts = append(completeParts, part)
+		}
+	}
 
-	// 使用 R2 返回的分片信息来完成上传
-	var completeParts []types.CompletedPart
-	for _, p := range r2Parts {
-		partNum := *p.PartNumber
-		etag := *p.ETag
-		completeParts = append(completeParts, types.CompletedPart{
-			PartNumber: &partNum,
-			ETag:       &etag,
+	if len(missing) > 0 || len(mismatched) > 0 {
+		log.Printf("[Upload] 分片校验失败: file_id=%s, 缺失=%v, 不一致=%v", file.ID, missing, mismatched)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(MultipartIncompleteResponse{
+			Error:           fmt.Sprintf("分片上传不完整: 缺失 %d 个，校验不一致 %d 个，请重新上传这些分片", len(missing), len(mismatched)),
+			TotalParts:      file.TotalParts,
+			MissingParts:    missing,
+			MismatchedParts: mismatched,
 		})
+		return
 	}
 
 	// 完成分片上传
-	if err := h.r2Service.CompleteMultipartUpload(file.R2Key, req.UploadID, completeParts); err != nil {
+	if err := h.storage.CompleteMultipartUpload(file.R2Key, file.UploadID, completeParts); err != nil {
 		log.Printf("[Upload] 完成分片上传失败: %v", err)
 		http.Error(w, `{"error":"完成分片上传失败"}`, http.StatusInternalServerError)
 		return
 	}
 
-	// 更新文件状态
-	file.UpdateStatus(h.db, "completed")
+	// 分片记录不再需要
+	file.ClearParts(h.db)
 
-	// 生成 R2 预签名下载直链（有效期与文件过期时间一致）
-	downloadURL, err := h.r2Service.GenerateDownloadURL(file.R2Key, file.Filename, time.Until(file.ExpiresAt))
-	if err != nil {
-		log.Printf("[Upload] 生成下载 URL 失败: %v", err)
-		// 即使生成失败也返回成功，使用备用链接
-		downloadURL = "/api/files/" + file.ID + "/download"
+	// 校验合并后的对象大小与声明一致
+	if status, err := h.verifyUploadedObject(file); err != nil {
+		log.Printf("[Upload] 上传校验失败: file_id=%s, %v", file.ID, err)
+		writeError(w, status, err.Error())
+		return
 	}
 
+	// 更新文件状态
+	file.UpdateStatusWithReason(h.db, "completed", file.StatusReason)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(MultipartCompleteResponse{
 		FileID:      file.ID,
-		DownloadURL: downloadURL,
+		DownloadURL: countedDownloadURL(file),
 		ShortURL:    "/s/" + file.ShortCode,
 		ExpiresAt:   file.ExpiresAt.Format(time.RFC3339),
 	})
@@ -408,16 +697,20 @@ func (h *UploadHandler) CancelUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 如果是分片上传，终止分片上传
-	if req.UploadID != "" {
-		if err := h.r2Service.AbortMultipartUpload(file.R2Key, req.UploadID); err != nil {
+	// 如果是分片上传，终止分片上传（客户端未提供时使用已保存的 uploadID）
+	uploadID := req.UploadID
+	if uploadID == "" {
+		uploadID = file.UploadID
+	}
+	if uploadID != "" {
+		if err := h.storage.AbortMultipartUpload(file.R2Key, uploadID); err != nil {
 			log.Printf("[Upload] 终止分片上传失败: %v", err)
 			// 继续执行，尝试删除可能已存在的对象
 		}
 	}
 
 	// 尝试删除 R2 中可能已存在的对象（小文件上传或部分完成的上传）
-	if err := h.r2Service.DeleteObject(file.R2Key); err != nil {
+	if err := h.storage.DeleteObject(file.R2Key); err != nil {
 		log.Printf("[Upload] 删除 R2 对象失败（可能不存在）: %v", err)
 		// 忽略错误，对象可能不存在
 	}
@@ -426,7 +719,7 @@ func (h *UploadHandler) CancelUpload(w http.ResponseWriter, r *http.Request) {
 	file.UpdateStatus(h.db, "cancelled")
 
 	// 删除数据库记录
-	h.db.Exec("DELETE FROM files WHERE id = ?", req.FileID)
+	models.DeleteFile(h.db, req.FileID)
 
 	log.Printf("[Upload] 上传已取消: file_id=%s", req.FileID)
 
@@ -436,3 +729,174 @@ func (h *UploadHandler) CancelUpload(w http.ResponseWriter, r *http.Request) {
 		Message: "上传已取消，R2 数据已清理",
 	})
 }
+
+// MultipartStatusResponse 分片上传状态响应（用于断点续传）
+type MultipartStatusResponse struct {
+	FileID         string            `json:"file_id"`
+	UploadID       string            `json:"upload_id"`
+	Filename       string            `json:"filename"`
+	ContentType    string            `json:"content_type"`
+	Size           int64             `json:"size"`
+	PartSize       int64             `json:"part_size"`
+	TotalParts     int               `json:"total_parts"`
+	CompletedParts []models.FilePart `json:"completed_parts"`
+	MissingParts   []int32           `json:"missing_parts"`
+	UploadedBytes  int64             `json:"uploaded_bytes"`
+	ExpiresAt      string            `json:"expires_at"`
+}
+
+// GetMultipartStatus 获取分片上传状态，返回仍需上传的分片（断点续传）
+// GET /api/upload/multipart/{file_id}
+func (h *UploadHandler) GetMultipartStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileID := strings.TrimPrefix(r.URL.Path, "/api/upload/multipart/")
+	if fileID == "" || strings.Contains(fileID, "/") {
+		http.Error(w, `{"error":"无效的请求"}`, http.StatusBadRequest)
+		return
+	}
+
+	file, err := models.GetFileByID(h.db, fileID)
+	if err != nil {
+		http.Error(w, `{"error":"文件不存在"}`, http.StatusNotFound)
+		return
+	}
+
+	if file.UploadStatus != "uploading" || file.UploadID == "" {
+		http.Error(w, `{"error":"该文件没有进行中的分片上传"}`, http.StatusConflict)
+		return
+	}
+
+	// 以存储中的实际分片为准，并同步到数据库
+	storageParts, err := h.storage.ListParts(file.R2Key, file.UploadID)
+	if err != nil {
+		log.Printf("[Upload] 列出分片失败: %v", err)
+		http.Error(w, `{"error":"列出分片失败"}`, http.StatusInternalServerError)
+		return
+	}
+
+	parts := make([]models.FilePart, 0, len(storageParts))
+	uploaded := make(map[int32]bool, len(storageParts))
+	var uploadedBytes int64
+	for _, p := range storageParts {
+		parts = append(parts, models.FilePart{PartNumber: p.PartNumber, ETag: p.ETag, Size: p.Size})
+		uploaded[p.PartNumber] = true
+		uploadedBytes += p.Size
+	}
+
+	if err := file.SaveParts(h.db, parts); err != nil {
+		log.Printf("[Upload] 保存分片记录失败: %v", err)
+	}
+
+	missing := []int32{}
+	for n := int32(1); n <= int32(file.TotalParts); n++ {
+		if !uploaded[n] {
+			missing = append(missing, n)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MultipartStatusResponse{
+		FileID:         file.ID,
+		UploadID:       file.UploadID,
+		Filename:       file.Filename,
+		ContentType:    file.ContentType,
+		Size:           file.Size,
+		PartSize:       file.PartSize,
+		TotalParts:     file.TotalParts,
+		CompletedParts: parts,
+		MissingParts:   missing,
+		UploadedBytes:  uploadedBytes,
+		ExpiresAt:      file.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// verifyUploadedObject 通过 HeadObject 校验存储中的对象与文件记录是否一致
+// 对象不存在时保留记录以便客户端重试；大小不一致时删除对象和记录（释放预留的配额）并拒绝；
+// 内容类型不一致时以实际对象为准修正记录，原因记录在 StatusReason 中
+func (h *UploadHandler) verifyUploadedObject(file *models.File) (int, error) {
+	info, err := h.storage.HeadObject(file.R2Key)
+	if err != nil {
+		if errors.Is(err, services.ErrObjectNotFound) {
+			return http.StatusConflict, fmt.Errorf("存储中未找到已上传的对象，请先完成上传")
+		}
+		return http.StatusBadGateway, fmt.Errorf("获取对象信息失败")
+	}
+
+	if info.Size != file.Size {
+		reason := fmt.Sprintf("对象大小与声明不一致: 声明 %d 字节，实际 %d 字节", file.Size, info.Size)
+		if err := h.storage.DeleteObject(file.R2Key); err != nil {
+			log.Printf("[Upload] 删除不一致的对象失败: %v", err)
+		}
+		log.Printf("[Upload] 拒绝上传并删除记录: file_id=%s, %s", file.ID, reason)
+		if err := models.DeleteFile(h.db, file.ID); err != nil {
+			log.Printf("[Upload] 删除文件记录失败: %v", err)
+		}
+		return http.StatusUnprocessableEntity, errors.New(reason)
+	}
+
+	if info.ContentType != "" && !sameMediaType(info.ContentType, file.ContentType) {
+		file.StatusReason = fmt.Sprintf("内容类型已按实际对象修正: %s -> %s", file.ContentType, info.ContentType)
+		if err := file.UpdateContentType(h.db, info.ContentType); err != nil {
+			log.Printf("[Upload] 修正内容类型失败: %v", err)
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
+// countedDownloadURL 上传完成后返回的下载链接
+// 经由下载接口计数并检查密码，不返回与文件同寿命的存储直链，避免绕过下载次数限制和分享密码
+func countedDownloadURL(file *models.File) string {
+	return "/api/files/" + file.ID + "/download"
+}
+
+// sameMediaType 比较两个 Content-Type 的媒体类型（忽略参数和大小写）
+func sameMediaType(a, b string) bool {
+	ma, _, errA := mime.ParseMediaType(a)
+	mb, _, errB := mime.ParseMediaType(b)
+	if errA != nil || errB != nil {
+		return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+	}
+	return ma == mb
+}
+
+// writeCreateError 返回创建文件记录失败的错误，配额不足时返回 507，自定义短码被占用时返回 409
+func writeCreateError(w http.ResponseWriter, err error) {
+	var takenErr *models.ShortCodeTakenError
+	if errors.As(err, &takenErr) {
+		writeShortCodeTaken(w, takenErr)
+		return
+	}
+
+	var quotaErr *models.QuotaError
+	if errors.As(err, &quotaErr) {
+		log.Printf("[Upload] %v", quotaErr)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInsufficientStorage)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": quotaErr.Error(),
+			"quota": quotaErr,
+		})
+		return
+	}
+
+	log.Printf("[Upload] 创建文件记录失败: %v", err)
+	http.Error(w, `{"error":"创建文件记录失败"}`, http.StatusInternalServerError)
+}
+
+// parseMaxDownloads 解析最大下载次数，为空或 0 表示不限制
+func parseMaxDownloads(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的最大下载次数: %s", value)
+	}
+	return n, nil
+}
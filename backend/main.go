@@ -12,6 +12,7 @@ import (
 	"r2box/middleware"
 	"r2box/models"
 	"r2box/services"
+	"strings"
 	"sync"
 	"time"
 )
@@ -24,16 +25,71 @@ var (
 
 // App 应用实例
 type App struct {
-	cfg       *config.Config
-	r2Service *services.R2Service
-	mu        sync.RWMutex
+	cfg         *config.Config
+	storage     services.Storage
+	reaper      *services.Reaper
+	tusBuffer   *services.ChunkBuffer
+	shareSecret []byte // 分享密码解锁令牌的签名密钥
+	mu          sync.RWMutex
 }
 
-// GetR2Service 获取 R2 服务（线程安全）
-func (a *App) GetR2Service() *services.R2Service {
+// GetStorage 获取存储后端（线程安全）
+func (a *App) GetStorage() services.Storage {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
-	return a.r2Service
+	return a.storage
+}
+
+// InitStorage 根据配置初始化存储后端，返回存储是否可用
+func (a *App) InitStorage() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch a.cfg.StorageBackend {
+	case services.BackendLocal:
+		secret, err := services.LoadSigningSecret(database.DB, a.cfg.StorageSigningSecret)
+		if err != nil {
+			log.Printf("[App] 警告: 加载签名密钥失败: %v", err)
+			return false
+		}
+		localStorage, err := services.NewLocalStorage(a.cfg.LocalStoragePath, secret)
+		if err != nil {
+			log.Printf("[App] 警告: 本地存储初始化失败: %v", err)
+			return false
+		}
+		a.storage = localStorage
+		log.Println("[App] 本地存储初始化成功")
+		return true
+
+	case services.BackendMemory:
+		secret, err := services.LoadSigningSecret(database.DB, a.cfg.StorageSigningSecret)
+		if err != nil {
+			log.Printf("[App] 警告: 加载签名密钥失败: %v", err)
+			return false
+		}
+		a.storage = services.NewMemoryStorage(secret)
+		log.Println("[App] 警告: 使用内存存储，重启后所有文件内容将丢失")
+		return true
+
+	case services.BackendR2:
+		r2Configured, _ := database.IsR2Configured()
+		if !r2Configured {
+			log.Println("[App] R2 尚未配置，等待用户配置")
+			return false
+		}
+		r2Service, err := services.NewR2Service(database.DB)
+		if err != nil {
+			log.Printf("[App] 警告: R2 服务初始化失败: %v", err)
+			return false
+		}
+		a.storage = r2Service
+		log.Println("[App] R2 服务初始化成功")
+		return true
+
+	default:
+		log.Printf("[App] 警告: 未知的存储后端: %s", a.cfg.StorageBackend)
+		return false
+	}
 }
 
 // ReloadR2Service 重新加载 R2 服务
@@ -41,6 +97,11 @@ func (a *App) ReloadR2Service() {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	if a.cfg.StorageBackend != services.BackendR2 {
+		log.Printf("[App] 当前存储后端为 %s，忽略 R2 配置变更", a.cfg.StorageBackend)
+		return
+	}
+
 	log.Println("[App] 重新加载 R2 服务...")
 
 	r2Service, err := services.NewR2Service(database.DB)
@@ -49,15 +110,15 @@ func (a *App) ReloadR2Service() {
 		return
 	}
 
-	a.r2Service = r2Service
+	a.storage = r2Service
 	log.Println("[App] R2 服务重新加载成功")
 }
 
 // StartCleanupTask 启动过期文件清理任务
 func (a *App) StartCleanupTask() {
 	cleanup := func() {
-		r2Service := a.GetR2Service()
-		if r2Service == nil {
+		storage := a.GetStorage()
+		if storage == nil {
 			return
 		}
 
@@ -68,8 +129,13 @@ func (a *App) StartCleanupTask() {
 		}
 
 		for _, file := range files {
-			// 删除 R2 对象
-			if err := r2Service.DeleteObject(file.R2Key); err != nil {
+			// 固定的文件永不过期（查询时已排除，这里再次确认以防查询后被固定）
+			if current, err := models.GetFileByID(database.DB, file.ID); err != nil || current.Pinned {
+				continue
+			}
+
+			// 删除存储对象
+			if err := storage.DeleteObject(file.R2Key); err != nil {
 				log.Printf("[Cleanup] 删除 R2 对象失败: %s, %v", file.R2Key, err)
 				continue
 			}
@@ -80,6 +146,34 @@ func (a *App) StartCleanupTask() {
 			}
 			log.Printf("[Cleanup] 已清理过期文件: %s (%s)", file.Filename, file.ID)
 		}
+
+		// 删除下载次数已用完且最后一次直链已失效的文件
+		burned, err := models.GetBurnedFiles(database.DB)
+		if err != nil {
+			log.Printf("[Cleanup] 获取已焚毁文件失败: %v", err)
+		}
+		for _, file := range burned {
+			if err := storage.DeleteObject(file.R2Key); err != nil {
+				log.Printf("[Cleanup] 删除 R2 对象失败: %s, %v", file.R2Key, err)
+				continue
+			}
+			if err := file.UpdateStatusWithReason(database.DB, "deleted", file.StatusReason); err != nil {
+				log.Printf("[Cleanup] 更新状态失败: %s, %v", file.ID, err)
+				continue
+			}
+			log.Printf("[Cleanup] 下载次数已用完，已删除文件: %s (%s)", file.Filename, file.ID)
+		}
+
+		// 清理过期的合集（其中的文件过期时间相同，已在上面清理）
+		if n, err := models.DeleteExpiredBundles(database.DB); err != nil {
+			log.Printf("[Cleanup] 清理过期合集失败: %v", err)
+		} else if n > 0 {
+			log.Printf("[Cleanup] 已清理 %d 个过期合集", n)
+		}
+
+		// 清理被放弃的分片上传和未确认的记录
+		a.reaper.Run(storage)
+		a.tusBuffer.Prune(a.cfg.StaleUploadAge)
 	}
 
 	go func() {
@@ -100,6 +194,9 @@ func main() {
 
 	// 加载配置
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("[App] 配置无效: %v", err)
+	}
 
 	// 初始化数据库
 	if err := database.Init(cfg.DatabasePath); err != nil {
@@ -109,28 +206,34 @@ func main() {
 
 	log.Println("[App] 数据库初始化成功")
 
-	// 创建应用实例
-	app := &App{cfg: cfg}
+	// tus 上传的分块缓冲目录（与数据库放在同一数据目录下）
+	tusBuffer, err := services.NewChunkBuffer(filepath.Join(filepath.Dir(cfg.DatabasePath), "tus"))
+	if err != nil {
+		log.Fatalf("[App] %v", err)
+	}
 
-	// 尝试初始化 R2 服务
-	r2Configured, _ := database.IsR2Configured()
-	if r2Configured {
-		r2Service, err := services.NewR2Service(database.DB)
-		if err != nil {
-			log.Printf("[App] 警告: R2 服务初始化失败: %v", err)
-		} else {
-			app.r2Service = r2Service
-			log.Println("[App] R2 服务初始化成功")
-		}
-	} else {
-		log.Println("[App] R2 尚未配置，等待用户配置")
+	// 分享密码解锁令牌的签名密钥（与自托管后端共用，签名内容带用途前缀）
+	shareSecret, err := services.LoadSigningSecret(database.DB, cfg.StorageSigningSecret)
+	if err != nil {
+		log.Fatalf("[App] 加载签名密钥失败: %v", err)
 	}
 
+	// 创建应用实例
+	app := &App{
+		cfg:         cfg,
+		reaper:      services.NewReaper(database.DB, cfg.StaleUploadAge, tusBuffer),
+		tusBuffer:   tusBuffer,
+		shareSecret: shareSecret,
+	}
+
+	// 初始化存储后端
+	storageReady := app.InitStorage()
+
 	// 创建路由器
 	mux := http.NewServeMux()
 
 	// 创建认证处理器
-	authHandler := handlers.NewAuthHandler(database.DB)
+	authHandler := handlers.NewAuthHandler(database.DB, cfg.StorageBackend)
 
 	// 公开路由（无需认证）
 	mux.HandleFunc("/api/auth/login", func(w http.ResponseWriter, r *http.Request) {
@@ -149,7 +252,7 @@ func main() {
 	})
 
 	// R2 配置向导（带配置变更回调）
-	setupHandler := handlers.NewSetupHandler(database.DB, func() {
+	setupHandler := handlers.NewSetupHandler(database.DB, cfg.StorageBackend, func() {
 		app.ReloadR2Service()
 	})
 
@@ -175,116 +278,223 @@ func main() {
 		setupHandler.TestConnection(w, r)
 	})))
 
+	// 上传选项（不依赖存储服务）
+	mux.Handle("/api/upload/options", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] GET /api/upload/options")
+		uploadHandler := handlers.NewUploadHandler(database.DB, nil, cfg)
+		uploadHandler.GetUploadOptions(w, r)
+	})))
+
 	// 上传路由（动态获取 R2 服务）
 	mux.Handle("/api/upload/presign", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[API] POST /api/upload/presign")
-		r2Service := app.GetR2Service()
-		if r2Service == nil {
+		storage := app.GetStorage()
+		if storage == nil {
 			log.Println("[API] R2 服务未初始化")
 			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
 			return
 		}
-		uploadHandler := handlers.NewUploadHandler(database.DB, r2Service, cfg.MaxFileSize)
+		uploadHandler := handlers.NewUploadHandler(database.DB, storage, cfg)
 		uploadHandler.GeneratePresignURL(w, r)
 	})))
 
 	mux.Handle("/api/upload/multipart/init", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[API] POST /api/upload/multipart/init")
-		r2Service := app.GetR2Service()
-		if r2Service == nil {
+		storage := app.GetStorage()
+		if storage == nil {
 			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
 			return
 		}
-		uploadHandler := handlers.NewUploadHandler(database.DB, r2Service, cfg.MaxFileSize)
+		uploadHandler := handlers.NewUploadHandler(database.DB, storage, cfg)
 		uploadHandler.InitiateMultipartUpload(w, r)
 	})))
 
 	mux.Handle("/api/upload/multipart/presign", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[API] POST /api/upload/multipart/presign")
-		r2Service := app.GetR2Service()
-		if r2Service == nil {
+		storage := app.GetStorage()
+		if storage == nil {
 			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
 			return
 		}
-		uploadHandler := handlers.NewUploadHandler(database.DB, r2Service, cfg.MaxFileSize)
+		uploadHandler := handlers.NewUploadHandler(database.DB, storage, cfg)
 		uploadHandler.GenerateMultipartPresignURL(w, r)
 	})))
 
+	mux.Handle("/api/upload/multipart/presign-batch", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] POST /api/upload/multipart/presign-batch")
+		storage := app.GetStorage()
+		if storage == nil {
+			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
+			return
+		}
+		uploadHandler := handlers.NewUploadHandler(database.DB, storage, cfg)
+		uploadHandler.GenerateMultipartPresignBatch(w, r)
+	})))
+
 	mux.Handle("/api/upload/multipart/complete", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[API] POST /api/upload/multipart/complete")
-		r2Service := app.GetR2Service()
-		if r2Service == nil {
+		storage := app.GetStorage()
+		if storage == nil {
 			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
 			return
 		}
-		uploadHandler := handlers.NewUploadHandler(database.DB, r2Service, cfg.MaxFileSize)
+		uploadHandler := handlers.NewUploadHandler(database.DB, storage, cfg)
 		uploadHandler.CompleteMultipartUpload(w, r)
 	})))
 
+	// 查询分片上传状态（断点续传）
+	mux.Handle("/api/upload/multipart/", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] GET /api/upload/multipart/...")
+		storage := app.GetStorage()
+		if storage == nil {
+			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
+			return
+		}
+		uploadHandler := handlers.NewUploadHandler(database.DB, storage, cfg)
+		uploadHandler.GetMultipartStatus(w, r)
+	})))
+
+	// 服务端中转上传（curl / 脚本）
+	streamUpload := middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] %s %s", r.Method, r.URL.Path)
+		storage := app.GetStorage()
+		if storage == nil {
+			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
+			return
+		}
+		uploadHandler := handlers.NewUploadHandler(database.DB, storage, cfg)
+		uploadHandler.StreamUpload(w, r)
+	}))
+	mux.Handle("/api/upload/stream", streamUpload)
+	mux.Handle("/api/upload/stream/", streamUpload)
+
+	// 文本片段（Pastebin）
+	mux.Handle("/api/pastes", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] POST /api/pastes")
+		storage := app.GetStorage()
+		if storage == nil {
+			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
+			return
+		}
+		uploadHandler := handlers.NewUploadHandler(database.DB, storage, cfg)
+		uploadHandler.CreatePaste(w, r)
+	})))
+
+	// tus 1.0 可续传上传（OPTIONS 用于协议发现，无需认证）
+	tusUpload := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] %s %s (tus)", r.Method, r.URL.Path)
+		storage := app.GetStorage()
+		if storage == nil {
+			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
+			return
+		}
+		tusHandler := handlers.NewTusHandler(database.DB, storage, cfg, app.tusBuffer)
+		if r.Method == http.MethodOptions {
+			tusHandler.ServeHTTP(w, r)
+			return
+		}
+		middleware.AuthMiddleware()(tusHandler).ServeHTTP(w, r)
+	})
+	mux.Handle("/api/tus", tusUpload)
+	mux.Handle("/api/tus/", tusUpload)
+
 	// 确认上传完成（小文件）
 	mux.Handle("/api/upload/confirm", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[API] POST /api/upload/confirm")
-		r2Service := app.GetR2Service()
-		if r2Service == nil {
+		storage := app.GetStorage()
+		if storage == nil {
 			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
 			return
 		}
-		uploadHandler := handlers.NewUploadHandler(database.DB, r2Service, cfg.MaxFileSize)
+		uploadHandler := handlers.NewUploadHandler(database.DB, storage, cfg)
 		uploadHandler.ConfirmUpload(w, r)
 	})))
 
 	// 取消上传
 	mux.Handle("/api/upload/cancel", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[API] POST /api/upload/cancel")
-		r2Service := app.GetR2Service()
-		if r2Service == nil {
+		storage := app.GetStorage()
+		if storage == nil {
 			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
 			return
 		}
-		uploadHandler := handlers.NewUploadHandler(database.DB, r2Service, cfg.MaxFileSize)
+		uploadHandler := handlers.NewUploadHandler(database.DB, storage, cfg)
 		uploadHandler.CancelUpload(w, r)
 	})))
 
 	// 文件列表路由
 	mux.Handle("/api/files", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[API] GET /api/files")
-		r2Service := app.GetR2Service()
-		if r2Service == nil {
+		storage := app.GetStorage()
+		if storage == nil {
 			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
 			return
 		}
-		filesHandler := handlers.NewFilesHandler(database.DB, r2Service)
+		filesHandler := handlers.NewFilesHandler(database.DB, storage, app.shareSecret)
 		filesHandler.List(w, r)
 	})))
 
+	// 自托管存储后端的签名 URL 上传/下载（签名即授权，无需登录）
+	mux.HandleFunc(services.SignedURLPrefix, func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] %s %s", r.Method, services.SignedURLPrefix+"...")
+		signedHandler, ok := app.GetStorage().(http.Handler)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		signedHandler.ServeHTTP(w, r)
+	})
+
 	// 短链接访问路由
 	mux.HandleFunc("/s/", func(w http.ResponseWriter, r *http.Request) {
-		shortCode := r.URL.Path[3:]
-		if shortCode == "" {
-			http.Error(w, "短码不能为空", http.StatusBadRequest)
+		storage := app.GetStorage()
+		if storage == nil {
+			http.Error(w, "存储未配置", http.StatusServiceUnavailable)
 			return
 		}
-
-		file, err := models.GetFileByShortCode(database.DB, shortCode)
-		if err != nil {
-			http.Error(w, "文件不存在", http.StatusNotFound)
+		filesHandler := handlers.NewFilesHandler(database.DB, storage, app.shareSecret)
+		if strings.HasSuffix(r.URL.Path, "/unlock") {
+			filesHandler.Unlock(w, r)
 			return
 		}
-
-		http.Redirect(w, r, "/api/files/"+file.ID+"/download", http.StatusFound)
+		if strings.HasSuffix(r.URL.Path, "/zip") {
+			filesHandler.BundleArchive(w, r)
+			return
+		}
+		filesHandler.ShortLink(w, r)
 	})
 
-	// 文件下载和删除路由
+	// 文件下载、打包下载、删除和固定路由
 	mux.HandleFunc("/api/files/", func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[API] %s /api/files/...", r.Method)
-		r2Service := app.GetR2Service()
-		if r2Service == nil {
+		storage := app.GetStorage()
+		if storage == nil {
 			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
 			return
 		}
-		filesHandler := handlers.NewFilesHandler(database.DB, r2Service)
+		filesHandler := handlers.NewFilesHandler(database.DB, storage, app.shareSecret)
 
-		if r.Method == http.MethodDelete {
+		if r.URL.Path == "/api/files/archive" {
+			// 打包下载需要认证
+			middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				filesHandler.Archive(w, r)
+			})).ServeHTTP(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/pin") {
+			// 固定/取消固定需要认证
+			middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				filesHandler.Pin(w, r)
+			})).ServeHTTP(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/short-code") {
+			// 修改短码需要认证
+			middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				filesHandler.SetShortCode(w, r)
+			})).ServeHTTP(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/password") {
+			// 设置分享密码需要认证
+			middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				filesHandler.SetPassword(w, r)
+			})).ServeHTTP(w, r)
+		} else if r.Method == http.MethodDelete {
 			// 删除需要认证
 			middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				filesHandler.Delete(w, r)
@@ -295,6 +505,70 @@ func main() {
 		}
 	})
 
+	// 文件合集路由（不依赖存储服务）
+	mux.Handle("/api/bundles", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] %s /api/bundles", r.Method)
+		bundlesHandler := handlers.NewBundlesHandler(database.DB, cfg)
+		switch r.Method {
+		case http.MethodGet:
+			bundlesHandler.List(w, r)
+		case http.MethodPost:
+			bundlesHandler.Create(w, r)
+		default:
+			http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		}
+	})))
+
+	mux.Handle("/api/bundles/", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] %s /api/bundles/...", r.Method)
+		bundlesHandler := handlers.NewBundlesHandler(database.DB, cfg)
+		// /api/bundles/:id 或 /api/bundles/:id/files[/:file_id]
+		parts := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+		switch {
+		case len(parts) == 4 && r.Method == http.MethodGet:
+			bundlesHandler.Get(w, r)
+		case len(parts) == 4 && r.Method == http.MethodDelete:
+			bundlesHandler.Delete(w, r)
+		case len(parts) == 5 && parts[4] == "files" && r.Method == http.MethodPost:
+			bundlesHandler.AddFiles(w, r)
+		case len(parts) == 6 && parts[4] == "files" && r.Method == http.MethodDelete:
+			bundlesHandler.RemoveFile(w, r)
+		default:
+			http.Error(w, `{"error":"方法不允许"}`, http.StatusMethodNotAllowed)
+		}
+	})))
+
+	// 自定义短码可用性检查（不依赖存储服务）
+	mux.Handle("/api/short-codes/", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] GET /api/short-codes/...")
+		filesHandler := handlers.NewFilesHandler(database.DB, nil, app.shareSecret)
+		filesHandler.CheckShortCode(w, r)
+	})))
+
+	// 对账路由（GET 仅报告，POST 执行修复）
+	mux.Handle("/api/admin/reconcile", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] %s /api/admin/reconcile", r.Method)
+		storage := app.GetStorage()
+		if storage == nil {
+			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
+			return
+		}
+		adminHandler := handlers.NewAdminHandler(database.DB, storage, app.reaper)
+		adminHandler.Reconcile(w, r)
+	})))
+
+	// 未完成上传清理路由（GET 查看最近报告，POST 立即执行）
+	mux.Handle("/api/admin/reaper", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] %s /api/admin/reaper", r.Method)
+		storage := app.GetStorage()
+		if storage == nil {
+			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
+			return
+		}
+		adminHandler := handlers.NewAdminHandler(database.DB, storage, app.reaper)
+		adminHandler.Reap(w, r)
+	})))
+
 	// 存储统计路由
 	mux.Handle("/api/stats", middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[API] GET /api/stats")
@@ -302,11 +576,33 @@ func main() {
 		statsHandler.GetStats(w, r)
 	})))
 
+	// transfer.sh 兼容上传（PUT /{filename}），认证方式与其他 API 相同
+	transferUpload := middleware.AuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("[API] PUT %s (transfer.sh)", r.URL.Path)
+		storage := app.GetStorage()
+		if storage == nil {
+			http.Error(w, `{"error":"R2 未配置，请先完成配置"}`, http.StatusServiceUnavailable)
+			return
+		}
+		uploadHandler := handlers.NewUploadHandler(database.DB, storage, cfg)
+		uploadHandler.TransferUpload(w, r)
+	}))
+
+	// transfer.sh 兼容下载（GET /{short_code}/{filename}），不需要认证；路径不对应文件时交给前端处理
+	transferDownload := func(w http.ResponseWriter, r *http.Request) bool {
+		storage := app.GetStorage()
+		if storage == nil {
+			return false
+		}
+		filesHandler := handlers.NewFilesHandler(database.DB, storage, app.shareSecret)
+		return filesHandler.TransferDownload(w, r)
+	}
+
 	// 静态文件服务（前端）
 	staticDir := "./static"
 	if _, err := os.Stat(staticDir); err == nil {
 		fs := http.FileServer(http.Dir(staticDir))
-		mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Handle("/", withTransfer(transferUpload, transferDownload, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// 如果请求的是 API 路径，返回 404
 			if len(r.URL.Path) >= 4 && r.URL.Path[:4] == "/api" {
 				http.NotFound(w, r)
@@ -322,10 +618,10 @@ func main() {
 			}
 
 			fs.ServeHTTP(w, r)
-		}))
+		})))
 	} else {
 		log.Println("[App] 警告: 静态文件目录不存在，前端将无法访问")
-		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mux.Handle("/", withTransfer(transferUpload, transferDownload, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "text/html; charset=utf-8")
 			fmt.Fprintf(w, `
 <!DOCTYPE html>
@@ -341,7 +637,7 @@ func main() {
 </body>
 </html>
 			`)
-		})
+		})))
 	}
 
 	// 应用速率限制中间件
@@ -358,10 +654,28 @@ func main() {
 	log.Printf("[App] R2Box 服务器启动成功")
 	log.Printf("[App] 地址: http://localhost%s", addr)
 	log.Printf("[App] 密码状态: %v", passwordSet)
-	log.Printf("[App] R2 配置状态: %v", r2Configured)
+	log.Printf("[App] 存储后端: %s, 就绪: %v", cfg.StorageBackend, storageReady)
 	log.Printf("[App] ========================================")
 
 	if err := http.ListenAndServe(addr, handler); err != nil {
 		log.Fatalf("[App] 服务器启动失败: %v", err)
 	}
 }
+
+// withTransfer 将根路径下的 PUT 请求交给 transfer.sh 兼容上传处理，/{short_code}/{filename} 形式的下载交给 download，其余请求交给 next
+func withTransfer(upload http.Handler, download func(w http.ResponseWriter, r *http.Request) bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodPut {
+			upload.ServeHTTP(w, r)
+			return
+		}
+		if download(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -37,6 +37,11 @@ func RateLimitMiddleware(db *sql.DB) func(http.Handler) http.Handler {
 	}
 }
 
+// ClientIP 获取客户端 IP（供处理器记录失败尝试使用）
+func ClientIP(r *http.Request) string {
+	return getClientIP(r)
+}
+
 // getClientIP 获取客户端 IP
 func getClientIP(r *http.Request) string {
 	// 尝试从 X-Forwarded-For 获取
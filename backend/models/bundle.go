@@ -0,0 +1,356 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Bundle 文件合集：多个已上传的文件共享一个短链接和过期时间
+type Bundle struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	ShortCode string    `json:"short_code"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Pinned    bool      `json:"pinned"` // 固定的合集永不过期
+	FileCount int       `json:"file_count"`
+
+	// Files 合集中的文件（按加入顺序），仅在查询详情时加载
+	Files []File `json:"files,omitempty"`
+
+	// Lifetime 有效期，创建记录时使用
+	Lifetime time.Duration `json:"-"`
+}
+
+// BundleFileError 文件无法加入合集
+type BundleFileError struct {
+	FileID string
+	Reason string
+}
+
+func (e *BundleFileError) Error() string {
+	return fmt.Sprintf("文件 %s %s", e.FileID, e.Reason)
+}
+
+// bundleColumns bundles 表查询列，顺序与 scanBundle 一致
+const bundleColumns = `id, COALESCE(title, ''), short_code, created_at, expires_at, COALESCE(pinned, 0),
+		(SELECT COUNT(*) FROM bundle_files WHERE bundle_files.bundle_id = bundles.id)`
+
+// scanBundle 扫描一行 bundles 记录
+func scanBundle(row rowScanner, b *Bundle) error {
+	return row.Scan(&b.ID, &b.Title, &b.ShortCode, &b.CreatedAt, &b.ExpiresAt, &b.Pinned, &b.FileCount)
+}
+
+// Create 创建合集并加入文件，有效期短于合集的文件延长到合集的过期时间
+// 已指定自定义短码时只尝试一次，被占用时返回 *ShortCodeTakenError
+func (b *Bundle) Create(db *sql.DB, fileIDs []string) error {
+	files, err := checkBundleFiles(db, "", fileIDs)
+	if err != nil {
+		return err
+	}
+
+	b.ID = uuid.New().String()
+	b.CreatedAt = time.Now()
+	b.ExpiresAt = b.CreatedAt.Add(b.Lifetime)
+
+	shortCodeMu.Lock()
+	defer shortCodeMu.Unlock()
+
+	custom := b.ShortCode != ""
+	if custom {
+		if err := releaseShortCode(db, b.ShortCode); err != nil {
+			return err
+		}
+		available, err := ShortCodeAvailable(db, b.ShortCode)
+		if err != nil {
+			return err
+		}
+		if !available {
+			return &ShortCodeTakenError{Code: b.ShortCode, Suggestions: SuggestShortCodes(db, b.ShortCode, 3)}
+		}
+	} else {
+		for i := 0; ; i++ {
+			if i == 10 {
+				return fmt.Errorf("生成短码失败")
+			}
+			code, err := generateShortCode()
+			if err != nil {
+				return err
+			}
+			available, err := ShortCodeAvailable(db, code)
+			if err != nil {
+				return err
+			}
+			if available {
+				b.ShortCode = code
+				break
+			}
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO bundles (id, title, short_code, created_at, expires_at, pinned)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, b.ID, b.Title, b.ShortCode, b.CreatedAt, b.ExpiresAt, b.Pinned)
+	if err != nil {
+		return err
+	}
+	if err := b.insertFiles(tx, files, 0); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	b.FileCount = len(files)
+	return nil
+}
+
+// AddFiles 向合集追加文件，有效期短于合集的文件延长到合集的过期时间
+func (b *Bundle) AddFiles(db *sql.DB, fileIDs []string) error {
+	files, err := checkBundleFiles(db, b.ID, fileIDs)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var position int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(position), 0) FROM bundle_files WHERE bundle_id = ?", b.ID).Scan(&position); err != nil {
+		return err
+	}
+	if err := b.insertFiles(tx, files, position); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	b.FileCount += len(files)
+	return nil
+}
+
+// insertFiles 写入合集成员，文件的有效期只会延长到合集的过期时间，不会缩短（固定的文件保持固定）
+// 文件原来的过期时间和固定状态记录在 bundle_files 中，移出合集或合集删除、过期时恢复
+func (b *Bundle) insertFiles(tx *sql.Tx, files []*File, position int) error {
+	for _, f := range files {
+		position++
+		_, err := tx.Exec(`
+			INSERT INTO bundle_files (file_id, bundle_id, position, original_expires_at, original_pinned)
+			VALUES (?, ?, ?, ?, ?)
+		`, f.ID, b.ID, position, f.ExpiresAt, f.Pinned)
+		if err != nil {
+			return err
+		}
+
+		expiresAt := f.ExpiresAt
+		if b.ExpiresAt.After(expiresAt) {
+			expiresAt = b.ExpiresAt
+		}
+		if _, err := tx.Exec("UPDATE files SET expires_at = ?, pinned = ? WHERE id = ?", expiresAt, f.Pinned || b.Pinned, f.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBundleFiles 检查文件能否加入合集：必须已上传完成、未过期，且不属于其他合集
+// 已在合集 bundleID 中的文件会被跳过
+func checkBundleFiles(db *sql.DB, bundleID string, fileIDs []string) ([]*File, error) {
+	var files []*File
+	seen := make(map[string]bool)
+	for _, id := range fileIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		f, err := GetFileByID(db, id)
+		if err != nil {
+			return nil, &BundleFileError{FileID: id, Reason: "不存在"}
+		}
+		if f.UploadStatus != "completed" {
+			return nil, &BundleFileError{FileID: id, Reason: "尚未上传完成"}
+		}
+		if f.Expired() || f.DownloadsExhausted() {
+			return nil, &BundleFileError{FileID: id, Reason: "已过期"}
+		}
+
+		var current string
+		err = db.QueryRow("SELECT bundle_id FROM bundle_files WHERE file_id = ?", id).Scan(&current)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if current == bundleID && bundleID != "" {
+			continue
+		}
+		if current != "" {
+			return nil, &BundleFileError{FileID: id, Reason: "已属于其他合集"}
+		}
+
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// RemoveFile 从合集移除文件（文件本身保留，恢复加入合集前的过期时间和固定状态），文件不在合集中时返回 false
+func (b *Bundle) RemoveFile(db *sql.DB, fileID string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := restoreBundleFiles(tx, "bundle_id = ? AND file_id = ?", b.ID, fileID); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec("DELETE FROM bundle_files WHERE bundle_id = ? AND file_id = ?", b.ID, fileID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	if n > 0 {
+		b.FileCount--
+	}
+	return n > 0, nil
+}
+
+// restoreBundleFiles 恢复 bundle_files 中满足 where 条件的文件加入合集前的过期时间和固定状态
+// 只处理仍有效的文件（已删除或下载次数已用完的文件保持原状）
+func restoreBundleFiles(tx *sql.Tx, where string, args ...interface{}) error {
+	_, err := tx.Exec(`
+		UPDATE files SET
+			expires_at = (SELECT original_expires_at FROM bundle_files WHERE bundle_files.file_id = files.id),
+			pinned = (SELECT original_pinned FROM bundle_files WHERE bundle_files.file_id = files.id)
+		WHERE upload_status = 'completed' AND id IN (SELECT file_id FROM bundle_files WHERE `+where+`)
+	`, args...)
+	return err
+}
+
+// LoadFiles 加载合集中的文件（按加入顺序）
+func (b *Bundle) LoadFiles(db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT `+fileColumns+`
+		FROM files JOIN bundle_files ON bundle_files.file_id = files.id
+		WHERE bundle_files.bundle_id = ?
+		ORDER BY bundle_files.position
+	`, b.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	b.Files = []File{}
+	for rows.Next() {
+		var f File
+		if err := scanFile(rows, &f); err != nil {
+			return err
+		}
+		b.Files = append(b.Files, f)
+	}
+	return rows.Err()
+}
+
+// Expired 合集是否已过期（固定的合集永不过期）
+func (b *Bundle) Expired() bool {
+	return !b.Pinned && time.Now().After(b.ExpiresAt)
+}
+
+// GetBundleByID 根据 ID 获取合集
+func GetBundleByID(db *sql.DB, id string) (*Bundle, error) {
+	b := &Bundle{}
+	err := scanBundle(db.QueryRow(`SELECT `+bundleColumns+` FROM bundles WHERE id = ?`, id), b)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("合集不存在")
+	}
+	return b, err
+}
+
+// GetBundleByShortCode 根据短码获取合集
+func GetBundleByShortCode(db *sql.DB, shortCode string) (*Bundle, error) {
+	b := &Bundle{}
+	err := scanBundle(db.QueryRow(`SELECT `+bundleColumns+` FROM bundles WHERE short_code = ?`, shortCode), b)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("合集不存在")
+	}
+	return b, err
+}
+
+// ListBundles 获取全部合集（按创建时间倒序）
+func ListBundles(db *sql.DB) ([]Bundle, error) {
+	rows, err := db.Query(`SELECT ` + bundleColumns + ` FROM bundles ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bundles := []Bundle{}
+	for rows.Next() {
+		var b Bundle
+		if err := scanBundle(rows, &b); err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, b)
+	}
+	return bundles, rows.Err()
+}
+
+// DeleteBundle 在一个事务中删除合集及其成员关系（不删除其中的文件，文件恢复加入合集前的过期时间和固定状态）
+func DeleteBundle(db *sql.DB, id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := restoreBundleFiles(tx, "bundle_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM bundle_files WHERE bundle_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM bundles WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteExpiredBundles 删除已过期的合集，其中的文件恢复原来的过期时间和固定状态（已过期的文件由文件清理任务删除），返回删除数量
+func DeleteExpiredBundles(db *sql.DB) (int, error) {
+	bundles, err := ListBundles(db)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, b := range bundles {
+		if !b.Expired() {
+			continue
+		}
+		if err := DeleteBundle(db, b.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
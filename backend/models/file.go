@@ -5,9 +5,20 @@ import (
 	"database/sql"
 	"fmt"
 	"math/big"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// R2KeyPrefix 所有对象 key 的公共前缀
+const R2KeyPrefix = "r2box/"
+
+// 记录类型
+const (
+	KindFile  = "file"  // 上传的文件
+	KindPaste = "paste" // 粘贴的文本片段
 )
 
 // File 文件元数据
@@ -17,11 +28,63 @@ type File struct {
 	R2Key        string    `json:"r2_key"`
 	Size         int64     `json:"size"`
 	ContentType  string    `json:"content_type"`
-	ExpiresIn    int       `json:"expires_in"`
+	ExpiresIn    int       `json:"expires_in"` // 有效期天数（向上取整，保留用于兼容）
 	CreatedAt    time.Time `json:"created_at"`
 	ExpiresAt    time.Time `json:"expires_at"`
 	UploadStatus string    `json:"upload_status"`
 	ShortCode    string    `json:"short_code"`
+	StatusReason string    `json:"status_reason,omitempty"` // 校验失败或修正记录的原因
+
+	// 下载次数限制（MaxDownloads 为 0 表示不限制）
+	MaxDownloads  int `json:"max_downloads"`
+	DownloadCount int `json:"download_count"`
+
+	// Pinned 固定的文件永不过期，直到手动删除或取消固定
+	Pinned bool `json:"pinned"`
+
+	// 分享密码：PasswordHash 为 bcrypt 哈希，HasPassword 由其派生
+	PasswordHash string `json:"-"`
+	HasPassword  bool   `json:"has_password"`
+
+	// Kind 记录类型（KindFile 或 KindPaste），Language 为文本片段的语言（用于语法高亮）
+	Kind     string `json:"kind"`
+	Language string `json:"language,omitempty"`
+
+	// Lifetime 有效期，创建记录时使用（为 0 时按 ExpiresIn 天数计算）
+	Lifetime time.Duration `json:"-"`
+
+	// 分片上传状态（用于断点续传）
+	UploadID   string `json:"-"`
+	PartSize   int64  `json:"-"`
+	TotalParts int    `json:"-"`
+}
+
+// FilePart 已上传的分片记录
+type FilePart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+}
+
+// fileColumns files 表查询列，顺序与 scanFile 一致
+const fileColumns = `id, filename, r2_key, size, content_type, expires_in, created_at, expires_at, upload_status,
+		COALESCE(short_code, ''), COALESCE(status_reason, ''), COALESCE(upload_id, ''), COALESCE(part_size, 0), COALESCE(total_parts, 0),
+		COALESCE(max_downloads, 0), COALESCE(download_count, 0), COALESCE(pinned, 0),
+		COALESCE(password_hash, ''), COALESCE(kind, 'file'), COALESCE(language, '')`
+
+// rowScanner 兼容 *sql.Row 和 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanFile 扫描一行 files 记录
+func scanFile(row rowScanner, f *File) error {
+	err := row.Scan(&f.ID, &f.Filename, &f.R2Key, &f.Size, &f.ContentType, &f.ExpiresIn, &f.CreatedAt, &f.ExpiresAt, &f.UploadStatus,
+		&f.ShortCode, &f.StatusReason, &f.UploadID, &f.PartSize, &f.TotalParts,
+		&f.MaxDownloads, &f.DownloadCount, &f.Pinned,
+		&f.PasswordHash, &f.Kind, &f.Language)
+	f.HasPassword = f.PasswordHash != ""
+	return err
 }
 
 // FileListItem 文件列表项（包含剩余时间）
@@ -30,6 +93,14 @@ type FileListItem struct {
 	RemainingTime string `json:"remaining_time"`
 }
 
+// TimeRemaining 剩余时间的可读形式，固定的文件为"永不过期"
+func (f *File) TimeRemaining() string {
+	if f.Pinned {
+		return "永不过期"
+	}
+	return formatDuration(time.Until(f.ExpiresAt))
+}
+
 // generateShortCode 生成6位短码
 func generateShortCode() (string, error) {
 	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
@@ -48,11 +119,13 @@ func generateShortCode() (string, error) {
 func (f *File) Create(db *sql.DB) error {
 	f.ID = uuid.New().String()
 	f.CreatedAt = time.Now()
-	// 支持30秒测试（-30表示30秒）
-	if f.ExpiresIn == -30 {
-		f.ExpiresAt = f.CreatedAt.Add(30 * time.Second)
-	} else {
-		f.ExpiresAt = f.CreatedAt.Add(time.Duration(f.ExpiresIn) * 24 * time.Hour)
+	if f.Lifetime <= 0 {
+		f.Lifetime = time.Duration(f.ExpiresIn) * 24 * time.Hour
+	}
+	f.ExpiresAt = f.CreatedAt.Add(f.Lifetime)
+	f.ExpiresIn = int((f.Lifetime + 24*time.Hour - 1) / (24 * time.Hour))
+	if f.Kind == "" {
+		f.Kind = KindFile
 	}
 
 	// 使用 UUID 作为 R2 key，避免文件名中的特殊字符导致问题
@@ -65,46 +138,384 @@ func (f *File) Create(db *sql.DB) error {
 		}
 	}
 	// 格式: r2box/UUID.扩展名
-	f.R2Key = fmt.Sprintf("r2box/%s%s", f.ID, ext)
+	f.R2Key = fmt.Sprintf("%s%s%s", R2KeyPrefix, f.ID, ext)
+
+	shortCodeMu.Lock()
+	defer shortCodeMu.Unlock()
+
+	// 已指定自定义短码时只尝试一次，被占用时返回 *ShortCodeTakenError
+	custom := f.ShortCode != ""
+	if custom {
+		if err := releaseShortCode(db, f.ShortCode); err != nil {
+			return err
+		}
+	}
 
 	// 生成短码，重试直到成功
 	for i := 0; i < 10; i++ {
-		code, err := generateShortCode()
+		if !custom {
+			code, err := generateShortCode()
+			if err != nil {
+				return err
+			}
+			f.ShortCode = code
+		}
+
+		// 短码已被合集占用时与唯一索引冲突同样处理
+		used, err := shortCodeUsedByBundle(db, f.ShortCode)
 		if err != nil {
 			return err
 		}
-		f.ShortCode = code
+		if used {
+			if custom {
+				return &ShortCodeTakenError{Code: f.ShortCode, Suggestions: SuggestShortCodes(db, f.ShortCode, 3)}
+			}
+			continue
+		}
 
 		_, err = db.Exec(`
-			INSERT INTO files (id, filename, r2_key, size, content_type, expires_in, created_at, expires_at, upload_status, short_code)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`, f.ID, f.Filename, f.R2Key, f.Size, f.ContentType, f.ExpiresIn, f.CreatedAt, f.ExpiresAt, f.UploadStatus, f.ShortCode)
+			INSERT INTO files (id, filename, r2_key, size, content_type, expires_in, created_at, expires_at, upload_status, short_code, max_downloads, pinned, password_hash, kind, language)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, f.ID, f.Filename, f.R2Key, f.Size, f.ContentType, f.ExpiresIn, f.CreatedAt, f.ExpiresAt, f.UploadStatus, f.ShortCode, f.MaxDownloads, f.Pinned, f.PasswordHash, f.Kind, f.Language)
 
 		if err == nil {
 			return nil
 		}
 		// 如果是唯一性冲突，重试
-		if err.Error() != "UNIQUE constraint failed: files.short_code" {
+		if !isShortCodeConflict(err) {
 			return err
 		}
+		if custom {
+			return &ShortCodeTakenError{Code: f.ShortCode, Suggestions: SuggestShortCodes(db, f.ShortCode, 3)}
+		}
 	}
 
 	return fmt.Errorf("生成短码失败")
 }
 
+// quotaMu 串行化配额检查与记录创建，避免并发上传同时通过检查
+var quotaMu sync.Mutex
+
+// QuotaError 存储配额不足
+type QuotaError struct {
+	Total    int64 `json:"total"`
+	Used     int64 `json:"used"`
+	Reserved int64 `json:"reserved"`
+	Required int64 `json:"required"`
+}
+
+func (e *QuotaError) Error() string {
+	available := e.Total - e.Used - e.Reserved
+	if available < 0 {
+		available = 0
+	}
+	return fmt.Sprintf("存储空间不足: 需要 %s，剩余可用 %s（已用 %s，上传中预留 %s，总计 %s）",
+		FormatBytes(e.Required), FormatBytes(available), FormatBytes(e.Used), FormatBytes(e.Reserved), FormatBytes(e.Total))
+}
+
+// GetUsedAndReservedSpace 获取已用空间（已完成和等待删除的 burned 文件）和预留空间（pending/uploading 的文件）
+func GetUsedAndReservedSpace(db *sql.DB) (used, reserved int64, err error) {
+	err = db.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN upload_status IN ('completed', 'burned') THEN size ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN upload_status IN ('pending', 'uploading') THEN size ELSE 0 END), 0)
+		FROM files
+	`).Scan(&used, &reserved)
+	return used, reserved, err
+}
+
+// CreateWithQuota 在存储配额内创建文件记录
+// 记录处于 pending/uploading 时即预留其声明的大小，取消或被清理删除记录后自动释放
+// totalStorage <= 0 表示不限制
+func (f *File) CreateWithQuota(db *sql.DB, totalStorage int64) error {
+	if totalStorage <= 0 {
+		return f.Create(db)
+	}
+
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+
+	used, reserved, err := GetUsedAndReservedSpace(db)
+	if err != nil {
+		return err
+	}
+	if used+reserved+f.Size > totalStorage {
+		return &QuotaError{Total: totalStorage, Used: used, Reserved: reserved, Required: f.Size}
+	}
+
+	return f.Create(db)
+}
+
+// GrowReservation 将上传中记录预留的大小增加到 size，超出存储配额时返回 *QuotaError
+// 用于长度未知的流式上传：按已接收的字节逐步预留，而不是一开始就按单文件上限预留
+func (f *File) GrowReservation(db *sql.DB, totalStorage, size int64) error {
+	if size <= f.Size {
+		return nil
+	}
+	if totalStorage > 0 {
+		quotaMu.Lock()
+		defer quotaMu.Unlock()
+
+		used, reserved, err := GetUsedAndReservedSpace(db)
+		if err != nil {
+			return err
+		}
+		reserved -= f.Size
+		if used+reserved+size > totalStorage {
+			return &QuotaError{Total: totalStorage, Used: used, Reserved: reserved, Required: size}
+		}
+	}
+	return f.UpdateSize(db, size)
+}
+
 // UpdateStatus 更新上传状态
 func (f *File) UpdateStatus(db *sql.DB, status string) error {
 	_, err := db.Exec("UPDATE files SET upload_status = ? WHERE id = ?", status, f.ID)
 	return err
 }
 
+// UpdateStatusWithReason 更新上传状态并记录原因
+func (f *File) UpdateStatusWithReason(db *sql.DB, status, reason string) error {
+	_, err := db.Exec("UPDATE files SET upload_status = ?, status_reason = ? WHERE id = ?", status, reason, f.ID)
+	if err != nil {
+		return err
+	}
+	f.UploadStatus = status
+	f.StatusReason = reason
+	return nil
+}
+
+// UpdateSize 更新文件大小（流式上传写入完成后才知道实际大小）
+func (f *File) UpdateSize(db *sql.DB, size int64) error {
+	_, err := db.Exec("UPDATE files SET size = ? WHERE id = ?", size, f.ID)
+	if err != nil {
+		return err
+	}
+	f.Size = size
+	return nil
+}
+
+// UpdateContentType 以存储中的实际内容类型修正记录
+func (f *File) UpdateContentType(db *sql.DB, contentType string) error {
+	_, err := db.Exec("UPDATE files SET content_type = ? WHERE id = ?", contentType, f.ID)
+	if err != nil {
+		return err
+	}
+	f.ContentType = contentType
+	return nil
+}
+
+// SaveMultipartState 保存分片上传状态并标记为上传中
+func (f *File) SaveMultipartState(db *sql.DB, uploadID string, partSize int64, totalParts int) error {
+	_, err := db.Exec(`
+		UPDATE files SET upload_id = ?, part_size = ?, total_parts = ?, upload_status = 'uploading'
+		WHERE id = ?
+	`, uploadID, partSize, totalParts, f.ID)
+	if err != nil {
+		return err
+	}
+	f.UploadID = uploadID
+	f.PartSize = partSize
+	f.TotalParts = totalParts
+	f.UploadStatus = "uploading"
+	return nil
+}
+
+// SaveParts 用存储中的实际分片列表覆盖已记录的分片
+func (f *File) SaveParts(db *sql.DB, parts []FilePart) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM file_parts WHERE file_id = ?", f.ID); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		_, err := tx.Exec(`
+			INSERT INTO file_parts (file_id, part_number, etag, size, updated_at)
+			VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		`, f.ID, p.PartNumber, p.ETag, p.Size)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SavePart 记录单个已上传的分片（服务端直接上传分片时使用）
+func (f *File) SavePart(db *sql.DB, p FilePart) error {
+	_, err := db.Exec(`
+		INSERT OR REPLACE INTO file_parts (file_id, part_number, etag, size, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, f.ID, p.PartNumber, p.ETag, p.Size)
+	return err
+}
+
+// PartLength 计算指定分片的字节数（最后一个分片可能较小），分片编号越界时返回 -1
+func (f *File) PartLength(partNumber int32) int64 {
+	if partNumber < 1 || int(partNumber) > f.TotalParts || f.PartSize <= 0 {
+		return -1
+	}
+	if int(partNumber) == f.TotalParts {
+		return f.Size - int64(f.TotalParts-1)*f.PartSize
+	}
+	return f.PartSize
+}
+
+// GetParts 获取已记录的分片（按分片编号排序）
+func (f *File) GetParts(db *sql.DB) ([]FilePart, error) {
+	rows, err := db.Query("SELECT part_number, etag, size FROM file_parts WHERE file_id = ? ORDER BY part_number", f.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parts := []FilePart{}
+	for rows.Next() {
+		var p FilePart
+		if err := rows.Scan(&p.PartNumber, &p.ETag, &p.Size); err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+	return parts, nil
+}
+
+// LastActivity 上传的最近活动时间：最近一次记录分片的时间，没有分片记录时为创建时间
+func (f *File) LastActivity(db *sql.DB) (time.Time, error) {
+	var updatedAt time.Time
+	err := db.QueryRow("SELECT updated_at FROM file_parts WHERE file_id = ? ORDER BY updated_at DESC LIMIT 1", f.ID).Scan(&updatedAt)
+	if err == sql.ErrNoRows {
+		return f.CreatedAt, nil
+	}
+	if err != nil {
+		return f.CreatedAt, err
+	}
+	if updatedAt.Before(f.CreatedAt) {
+		return f.CreatedAt, nil
+	}
+	return updatedAt, nil
+}
+
+// ClearParts 删除已记录的分片（上传完成或取消后调用）
+func (f *File) ClearParts(db *sql.DB) error {
+	_, err := db.Exec("DELETE FROM file_parts WHERE file_id = ?", f.ID)
+	return err
+}
+
+// ConsumeDownload 原子地占用一次下载次数，次数已用完时返回 false
+// 成功时 f.DownloadCount 更新为数据库中的最新计数，可据此判断是否为最后一次下载
+func (f *File) ConsumeDownload(db *sql.DB) (bool, error) {
+	err := db.QueryRow(`
+		UPDATE files SET download_count = COALESCE(download_count, 0) + 1
+		WHERE id = ? AND (COALESCE(max_downloads, 0) = 0 OR COALESCE(download_count, 0) < max_downloads)
+		RETURNING download_count
+	`, f.ID).Scan(&f.DownloadCount)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DownloadsExhausted 下载次数是否已用完
+func (f *File) DownloadsExhausted() bool {
+	return f.MaxDownloads > 0 && f.DownloadCount >= f.MaxDownloads
+}
+
+// MarkBurned 下载次数用完后将文件标记为 burned（阅后即焚），deleteAfter 之后由清理任务删除对象
+// 同时取消固定，burned 状态持久化在数据库中，进程重启后清理任务仍会删除对象
+func (f *File) MarkBurned(db *sql.DB, deleteAfter time.Time) error {
+	const reason = "下载次数已用完"
+	_, err := db.Exec(`
+		UPDATE files SET upload_status = 'burned', status_reason = ?, expires_at = ?, pinned = 0
+		WHERE id = ? AND upload_status = 'completed'
+	`, reason, deleteAfter, f.ID)
+	if err == nil {
+		f.UploadStatus = "burned"
+		f.StatusReason = reason
+		f.ExpiresAt = deleteAfter
+		f.Pinned = false
+	}
+	return err
+}
+
+// SetPinned 固定或取消固定文件
+// 取消固定时若原过期时间已过，从当前时间起重新计算原有效期，避免文件被立即清理
+func (f *File) SetPinned(db *sql.DB, pinned bool) error {
+	expiresAt := f.ExpiresAt
+	if !pinned && time.Now().After(expiresAt) {
+		expiresAt = time.Now().Add(f.ExpiresAt.Sub(f.CreatedAt))
+	}
+
+	_, err := db.Exec("UPDATE files SET pinned = ?, expires_at = ? WHERE id = ?", pinned, expiresAt, f.ID)
+	if err == nil {
+		f.Pinned = pinned
+		f.ExpiresAt = expiresAt
+	}
+	return err
+}
+
+// HashSharePassword 生成分享密码的 bcrypt 哈希
+// 分享密码通常较短且可被匿名访问者反复尝试，使用慢哈希增加离线破解的成本
+func HashSharePassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword 校验分享密码（未设置密码时总是通过）
+func (f *File) CheckPassword(password string) bool {
+	if f.PasswordHash == "" {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(f.PasswordHash), []byte(password)) == nil
+}
+
+// SetPassword 设置分享密码，为空时取消密码保护
+func (f *File) SetPassword(db *sql.DB, password string) error {
+	hash := ""
+	if password != "" {
+		var err error
+		if hash, err = HashSharePassword(password); err != nil {
+			return err
+		}
+	}
+
+	_, err := db.Exec("UPDATE files SET password_hash = ? WHERE id = ?", hash, f.ID)
+	if err == nil {
+		f.PasswordHash = hash
+		f.HasPassword = hash != ""
+	}
+	return err
+}
+
+// Expired 文件是否已过期（固定的文件永不过期）
+func (f *File) Expired() bool {
+	return !f.Pinned && time.Now().After(f.ExpiresAt)
+}
+
+// LinkTTL 下载直链的有效期：不超过文件剩余有效期，固定的文件为 24 小时
+func (f *File) LinkTTL() time.Duration {
+	if f.Pinned {
+		return 24 * time.Hour
+	}
+	return time.Until(f.ExpiresAt)
+}
+
 // GetByID 根据 ID 获取文件
 func GetFileByID(db *sql.DB, id string) (*File, error) {
 	f := &File{}
-	err := db.QueryRow(`
-		SELECT id, filename, r2_key, size, content_type, expires_in, created_at, expires_at, upload_status, COALESCE(short_code, '')
+	err := scanFile(db.QueryRow(`
+		SELECT `+fileColumns+`
 		FROM files WHERE id = ?
-	`, id).Scan(&f.ID, &f.Filename, &f.R2Key, &f.Size, &f.ContentType, &f.ExpiresIn, &f.CreatedAt, &f.ExpiresAt, &f.UploadStatus, &f.ShortCode)
+	`, id), f)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("文件不存在")
@@ -115,10 +526,10 @@ func GetFileByID(db *sql.DB, id string) (*File, error) {
 // GetFileByShortCode 根据短码获取文件
 func GetFileByShortCode(db *sql.DB, shortCode string) (*File, error) {
 	f := &File{}
-	err := db.QueryRow(`
-		SELECT id, filename, r2_key, size, content_type, expires_in, created_at, expires_at, upload_status, COALESCE(short_code, '')
+	err := scanFile(db.QueryRow(`
+		SELECT `+fileColumns+`
 		FROM files WHERE short_code = ?
-	`, shortCode).Scan(&f.ID, &f.Filename, &f.R2Key, &f.Size, &f.ContentType, &f.ExpiresIn, &f.CreatedAt, &f.ExpiresAt, &f.UploadStatus, &f.ShortCode)
+	`, shortCode), f)
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("文件不存在")
@@ -130,18 +541,18 @@ func GetFileByShortCode(db *sql.DB, shortCode string) (*File, error) {
 func ListFiles(db *sql.DB, page, limit int) ([]FileListItem, int, error) {
 	offset := (page - 1) * limit
 
-	// 获取总数（包含已完成和已删除的文件）
+	// 获取总数（包含已完成、已焚毁、已删除和对象丢失的文件）
 	var total int
-	err := db.QueryRow("SELECT COUNT(*) FROM files WHERE upload_status IN ('completed', 'deleted')").Scan(&total)
+	err := db.QueryRow("SELECT COUNT(*) FROM files WHERE upload_status IN ('completed', 'burned', 'deleted', 'missing')").Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	// 获取文件列表（包含已完成和已删除的文件）
+	// 获取文件列表（包含已完成、已焚毁、已删除和对象丢失的文件）
 	rows, err := db.Query(`
-		SELECT id, filename, r2_key, size, content_type, expires_in, created_at, expires_at, upload_status, COALESCE(short_code, '')
+		SELECT `+fileColumns+`
 		FROM files
-		WHERE upload_status IN ('completed', 'deleted')
+		WHERE upload_status IN ('completed', 'burned', 'deleted', 'missing')
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?
 	`, limit, offset)
@@ -153,18 +564,14 @@ func ListFiles(db *sql.DB, page, limit int) ([]FileListItem, int, error) {
 	var files []FileListItem
 	for rows.Next() {
 		var f File
-		err := rows.Scan(&f.ID, &f.Filename, &f.R2Key, &f.Size, &f.ContentType, &f.ExpiresIn, &f.CreatedAt, &f.ExpiresAt, &f.UploadStatus, &f.ShortCode)
+		err := scanFile(rows, &f)
 		if err != nil {
 			return nil, 0, err
 		}
 
-		// 计算剩余时间
-		remaining := time.Until(f.ExpiresAt)
-		remainingStr := formatDuration(remaining)
-
 		files = append(files, FileListItem{
 			File:          f,
-			RemainingTime: remainingStr,
+			RemainingTime: f.TimeRemaining(),
 		})
 	}
 
@@ -173,17 +580,23 @@ func ListFiles(db *sql.DB, page, limit int) ([]FileListItem, int, error) {
 
 // DeleteFile 删除文件记录
 func DeleteFile(db *sql.DB, id string) error {
+	if _, err := db.Exec("DELETE FROM file_parts WHERE file_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := db.Exec("DELETE FROM bundle_files WHERE file_id = ?", id); err != nil {
+		return err
+	}
 	_, err := db.Exec("DELETE FROM files WHERE id = ?", id)
 	return err
 }
 
-// GetExpiredFiles 获取已过期且未删除的文件
+// GetExpiredFiles 获取已过期且未删除的文件（不含固定的文件）
 func GetExpiredFiles(db *sql.DB) ([]File, error) {
 	now := time.Now().Format("2006-01-02 15:04:05")
 	rows, err := db.Query(`
-		SELECT id, filename, r2_key, size, content_type, expires_in, created_at, expires_at, upload_status, COALESCE(short_code, '')
+		SELECT `+fileColumns+`
 		FROM files
-		WHERE expires_at < ? AND upload_status = 'completed'
+		WHERE expires_at < ? AND upload_status = 'completed' AND COALESCE(pinned, 0) = 0
 	`, now)
 	if err != nil {
 		return nil, err
@@ -193,7 +606,81 @@ func GetExpiredFiles(db *sql.DB) ([]File, error) {
 	var files []File
 	for rows.Next() {
 		var f File
-		err := rows.Scan(&f.ID, &f.Filename, &f.R2Key, &f.Size, &f.ContentType, &f.ExpiresIn, &f.CreatedAt, &f.ExpiresAt, &f.UploadStatus, &f.ShortCode)
+		err := scanFile(rows, &f)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// GetBurnedFiles 获取下载次数已用完且最后一次直链已失效（expires_at 已过）的 burned 文件
+func GetBurnedFiles(db *sql.DB) ([]File, error) {
+	now := time.Now().Format("2006-01-02 15:04:05")
+	rows, err := db.Query(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE upload_status = 'burned' AND expires_at < ?
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		var f File
+		err := scanFile(rows, &f)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// GetStaleUploads 获取创建时间早于 before 且仍处于 pending/uploading 状态的文件
+// 创建后仍在上传分片的记录同样会返回，调用方需按 LastActivity 判断是否仍有活动
+func GetStaleUploads(db *sql.DB, before time.Time) ([]File, error) {
+	rows, err := db.Query(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE upload_status IN ('pending', 'uploading') AND created_at < ?
+	`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		var f File
+		err := scanFile(rows, &f)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// GetFilesByR2KeyPrefix 获取 R2 key 以指定前缀开头的全部文件记录（用于对账）
+func GetFilesByR2KeyPrefix(db *sql.DB, prefix string) ([]File, error) {
+	rows, err := db.Query(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE r2_key LIKE ? || '%'
+	`, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		var f File
+		err := scanFile(rows, &f)
 		if err != nil {
 			return nil, err
 		}
@@ -204,10 +691,22 @@ func GetExpiredFiles(db *sql.DB) ([]File, error) {
 
 // GetStorageStats 获取存储统计
 func GetStorageStats(db *sql.DB, totalStorage int64) (map[string]interface{}, error) {
-	var usedSpace int64
+	// 已用空间与配额检查一致（包含等待删除的 burned 文件），另有上传中预留的空间
+	usedSpace, reservedSpace, err := GetUsedAndReservedSpace(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// 可下载的文件数
 	var fileCount int
+	if err := db.QueryRow("SELECT COUNT(*) FROM files WHERE upload_status = 'completed'").Scan(&fileCount); err != nil {
+		return nil, err
+	}
 
-	err := db.QueryRow("SELECT COALESCE(SUM(size), 0), COUNT(*) FROM files WHERE upload_status = 'completed'").Scan(&usedSpace, &fileCount)
+	// 固定（永不过期）的文件，已包含在已用空间中
+	var pinnedSpace int64
+	var pinnedCount int
+	err = db.QueryRow("SELECT COALESCE(SUM(size), 0), COUNT(*) FROM files WHERE upload_status = 'completed' AND pinned = 1").Scan(&pinnedSpace, &pinnedCount)
 	if err != nil {
 		return nil, err
 	}
@@ -215,20 +714,29 @@ func GetStorageStats(db *sql.DB, totalStorage int64) (map[string]interface{}, er
 	// 今天过期的文件数
 	var expiringToday int
 	today := time.Now().Truncate(24 * time.Hour).Add(24 * time.Hour)
-	db.QueryRow("SELECT COUNT(*) FROM files WHERE expires_at < ? AND upload_status = 'completed'", today).Scan(&expiringToday)
+	db.QueryRow("SELECT COUNT(*) FROM files WHERE expires_at < ? AND upload_status = 'completed' AND COALESCE(pinned, 0) = 0", today).Scan(&expiringToday)
 
 	// 本周过期的文件数
 	var expiringThisWeek int
 	nextWeek := time.Now().Add(7 * 24 * time.Hour)
-	db.QueryRow("SELECT COUNT(*) FROM files WHERE expires_at < ? AND upload_status = 'completed'", nextWeek).Scan(&expiringThisWeek)
+	db.QueryRow("SELECT COUNT(*) FROM files WHERE expires_at < ? AND upload_status = 'completed' AND COALESCE(pinned, 0) = 0", nextWeek).Scan(&expiringThisWeek)
 
-	usagePercent := float64(usedSpace) / float64(totalStorage) * 100
+	// totalStorage <= 0 表示不限制容量
+	var usagePercent float64
+	if totalStorage > 0 {
+		usagePercent = float64(usedSpace) / float64(totalStorage) * 100
+	}
 
 	return map[string]interface{}{
 		"usedSpace":           usedSpace,
 		"totalSpace":          totalStorage,
-		"usedSpaceFormatted":  formatBytes(usedSpace),
-		"totalSpaceFormatted": formatBytes(totalStorage),
+		"usedSpaceFormatted":  FormatBytes(usedSpace),
+		"reservedSpace":       reservedSpace,
+		"reservedFormatted":   FormatBytes(reservedSpace),
+		"pinnedSpace":         pinnedSpace,
+		"pinnedFormatted":     FormatBytes(pinnedSpace),
+		"pinnedCount":         pinnedCount,
+		"totalSpaceFormatted": FormatBytes(totalStorage),
 		"usagePercent":        usagePercent,
 		"fileCount":           fileCount,
 		"expiringToday":       expiringToday,
@@ -255,8 +763,8 @@ func formatDuration(d time.Duration) string {
 	}
 }
 
-// formatBytes 格式化字节数
-func formatBytes(bytes int64) string {
+// FormatBytes 格式化字节数
+func FormatBytes(bytes int64) string {
 	const unit = 1024
 	if bytes < unit {
 		return fmt.Sprintf("%d B", bytes)
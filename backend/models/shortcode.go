@@ -0,0 +1,130 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// shortCodeMu 串行化短码的检查与占用
+// 文件和合集的短码共用 /s/ 命名空间，但分别存放在两张表中，唯一索引无法跨表约束
+var shortCodeMu sync.Mutex
+
+// shortCodePattern 自定义短码：3-64 位字母、数字、- 或 _，以字母或数字开头
+var shortCodePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{2,63}$`)
+
+// reservedShortCodes 保留字（不区分大小写），避免与系统页面、/s/ 下的子路由（unlock、zip）混淆或被用于仿冒
+var reservedShortCodes = map[string]bool{
+	"admin": true, "api": true, "assets": true, "download": true, "files": true,
+	"login": true, "logout": true, "password": true, "r2box": true, "s": true,
+	"settings": true, "setup": true, "static": true, "stats": true, "tus": true,
+	"unlock": true, "upload": true, "zip": true,
+}
+
+// ShortCodeTakenError 自定义短码已被占用
+type ShortCodeTakenError struct {
+	Code        string   `json:"code"`
+	Suggestions []string `json:"suggestions"`
+}
+
+func (e *ShortCodeTakenError) Error() string {
+	return fmt.Sprintf("短码 %s 已被占用", e.Code)
+}
+
+// ValidateShortCode 校验自定义短码的字符、长度和保留字
+func ValidateShortCode(code string) error {
+	if !shortCodePattern.MatchString(code) {
+		return fmt.Errorf("短码只能包含字母、数字、- 和 _，以字母或数字开头，长度 3-64 位")
+	}
+	if reservedShortCodes[strings.ToLower(code)] {
+		return fmt.Errorf("短码 %s 是保留字", code)
+	}
+	return nil
+}
+
+// ShortCodeAvailable 短码是否可用（未被文件或合集占用，已删除文件的短码可以重新使用）
+func ShortCodeAvailable(db *sql.DB, code string) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM files WHERE short_code = ? AND upload_status != 'deleted')
+			+ (SELECT COUNT(*) FROM bundles WHERE short_code = ?)
+	`, code, code).Scan(&count)
+	return count == 0, err
+}
+
+// shortCodeUsedByBundle 短码是否已被合集占用
+func shortCodeUsedByBundle(db *sql.DB, code string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM bundles WHERE short_code = ?", code).Scan(&count)
+	return count > 0, err
+}
+
+// SuggestShortCodes 为已被占用的短码生成最多 limit 个可用的替代短码
+func SuggestShortCodes(db *sql.DB, code string, limit int) []string {
+	var candidates []string
+	for i := 2; i <= 9; i++ {
+		candidates = append(candidates, fmt.Sprintf("%s-%d", code, i))
+	}
+	for i := 0; i < 3; i++ {
+		if suffix, err := generateShortCode(); err == nil {
+			candidates = append(candidates, code+"-"+strings.ToLower(suffix[:4]))
+		}
+	}
+
+	suggestions := []string{}
+	for _, candidate := range candidates {
+		if len(suggestions) >= limit {
+			break
+		}
+		if ValidateShortCode(candidate) != nil {
+			continue
+		}
+		if ok, err := ShortCodeAvailable(db, candidate); err == nil && ok {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	return suggestions
+}
+
+// SetShortCode 修改文件短码，已被占用时返回 *ShortCodeTakenError
+func (f *File) SetShortCode(db *sql.DB, code string) error {
+	shortCodeMu.Lock()
+	defer shortCodeMu.Unlock()
+
+	if err := releaseShortCode(db, code); err != nil {
+		return err
+	}
+	used, err := shortCodeUsedByBundle(db, code)
+	if err != nil {
+		return err
+	}
+	if used {
+		return &ShortCodeTakenError{Code: code, Suggestions: SuggestShortCodes(db, code, 3)}
+	}
+
+	_, err = db.Exec("UPDATE files SET short_code = ? WHERE id = ?", code, f.ID)
+	if isShortCodeConflict(err) {
+		return &ShortCodeTakenError{Code: code, Suggestions: SuggestShortCodes(db, code, 3)}
+	}
+	if err == nil {
+		f.ShortCode = code
+	}
+	return err
+}
+
+// releaseShortCode 释放已删除文件占用的短码，使其可以被重新使用
+func releaseShortCode(db *sql.DB, code string) error {
+	_, err := db.Exec("UPDATE files SET short_code = NULL WHERE short_code = ? AND upload_status = 'deleted'", code)
+	return err
+}
+
+// isShortCodeConflict 是否为短码唯一索引冲突
+func isShortCodeConflict(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return msg == "UNIQUE constraint failed: files.short_code" || msg == "UNIQUE constraint failed: bundles.short_code"
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateShortCode(t *testing.T) {
+	tests := []struct {
+		code    string
+		wantErr bool
+	}{
+		{code: "q3-report"},
+		{code: "abc"},
+		{code: "A_b-9"},
+		{code: "0day"},
+		{code: strings.Repeat("a", 64)},
+		{code: "ab", wantErr: true},
+		{code: strings.Repeat("a", 65), wantErr: true},
+		{code: "", wantErr: true},
+		{code: "-abc", wantErr: true},
+		{code: "_abc", wantErr: true},
+		{code: "has space", wantErr: true},
+		{code: "a/b/c", wantErr: true},
+		{code: "a.b.c", wantErr: true},
+		{code: "报告abc", wantErr: true},
+		{code: "admin", wantErr: true},
+		{code: "ADMIN", wantErr: true},
+		{code: "Unlock", wantErr: true},
+		{code: "zip", wantErr: true},
+		{code: "Zip", wantErr: true},
+		{code: "zip-files"},
+		{code: "api", wantErr: true},
+		{code: "admin-panel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			err := ValidateShortCode(tt.code)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateShortCode(%q) err = %v, wantErr %v", tt.code, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChunkBuffer 在磁盘上暂存不足一个分片的上传数据
+// 用于 tus 等按任意大小分块上传的协议：数据攒满一个分片后再上传到存储
+// 缓冲文件丢失（如重启后被清理）只会让上传偏移量回退到已提交的分片，客户端可从该偏移量继续
+type ChunkBuffer struct {
+	dir string
+}
+
+// NewChunkBuffer 创建分块缓冲区
+func NewChunkBuffer(dir string) (*ChunkBuffer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建缓冲目录失败: %w", err)
+	}
+	return &ChunkBuffer{dir: dir}, nil
+}
+
+// path 获取缓冲文件路径（id 必须为 UUID，防止路径穿越）
+func (b *ChunkBuffer) path(id string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", fmt.Errorf("无效的缓冲 ID: %s", id)
+	}
+	return filepath.Join(b.dir, id+".buf"), nil
+}
+
+// Size 获取已缓冲的字节数，缓冲文件不存在时返回 0
+func (b *ChunkBuffer) Size(id string) (int64, error) {
+	path, err := b.path(id)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// ModTime 获取缓冲区最近一次写入的时间，缓冲文件不存在时返回零值
+func (b *ChunkBuffer) ModTime(id string) (time.Time, error) {
+	path, err := b.path(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// Append 从 r 读取最多 n 字节追加到缓冲区，返回实际写入的字节数
+// r 提前结束时返回 io.EOF
+func (b *ChunkBuffer) Append(id string, r io.Reader, n int64) (int64, error) {
+	path, err := b.path(id)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := io.CopyN(f, r, n)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return written, err
+}
+
+// Open 打开缓冲文件用于读取
+func (b *ChunkBuffer) Open(id string) (*os.File, error) {
+	path, err := b.path(id)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Reset 清空缓冲区
+func (b *ChunkBuffer) Reset(id string) error {
+	path, err := b.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Prune 删除超过 maxAge 未更新的缓冲文件（对应的上传已被清理任务终止）
+func (b *ChunkBuffer) Prune(maxAge time.Duration) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		log.Printf("[Buffer] 读取缓冲目录失败: %v", err)
+		return
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(b.dir, entry.Name())); err != nil {
+			log.Printf("[Buffer] 删除过期缓冲文件失败: %s, %v", entry.Name(), err)
+			continue
+		}
+		log.Printf("[Buffer] 已删除过期缓冲文件: %s", entry.Name())
+	}
+}
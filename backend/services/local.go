@@ -0,0 +1,594 @@
+package services
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LocalStorage 本地文件系统存储
+// 对象保存在数据目录下，上传和下载通过 r2box 自身的签名 URL 完成
+type LocalStorage struct {
+	root    string
+	signer  *urlSigner
+	handler *signedHandler
+}
+
+// localMeta 对象元数据（与对象文件分开保存）
+type localMeta struct {
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+	Size        int64  `json:"size"`
+}
+
+// localUpload 分片上传元数据
+type localUpload struct {
+	Key         string    `json:"key"`
+	ContentType string    `json:"content_type"`
+	Initiated   time.Time `json:"initiated"`
+}
+
+// NewLocalStorage 创建本地存储实例
+func NewLocalStorage(root string, secret []byte) (*LocalStorage, error) {
+	log.Printf("[Local] 正在初始化本地存储: %s", root)
+
+	for _, dir := range []string{"objects", "meta", "multipart"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return nil, fmt.Errorf("创建存储目录失败: %w", err)
+		}
+	}
+
+	s := &LocalStorage{
+		root:   root,
+		signer: &urlSigner{secret: secret},
+	}
+	s.handler = &signedHandler{signer: s.signer, store: s}
+
+	log.Println("[Local] 本地存储初始化成功")
+	return s, nil
+}
+
+// ServeHTTP 处理签名 URL 的上传和下载
+func (s *LocalStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// resolve 将对象 key 转换为数据目录下的安全路径
+func (s *LocalStorage) resolve(dir, key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" {
+		return "", fmt.Errorf("无效的对象 key: %s", key)
+	}
+	return filepath.Join(s.root, dir, filepath.FromSlash(cleaned)), nil
+}
+
+// uploadDir 获取分片上传目录
+func (s *LocalStorage) uploadDir(uploadID string) (string, error) {
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return "", fmt.Errorf("无效的 uploadID: %s", uploadID)
+	}
+	return filepath.Join(s.root, "multipart", uploadID), nil
+}
+
+// loadUpload 读取分片上传元数据并校验 key
+func (s *LocalStorage) loadUpload(key, uploadID string) (string, *localUpload, error) {
+	dir, err := s.uploadDir(uploadID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "upload.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, fmt.Errorf("分片上传不存在: %w", ErrObjectNotFound)
+		}
+		return "", nil, err
+	}
+
+	var upload localUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return "", nil, err
+	}
+	if upload.Key != key {
+		return "", nil, fmt.Errorf("分片上传与 key 不匹配: %w", ErrObjectNotFound)
+	}
+	return dir, &upload, nil
+}
+
+// writeFile 先写入临时文件再重命名，返回 MD5 和大小
+func writeFile(path string, body io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// writeJSON 写入 JSON 文件
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// putObject 写入对象
+func (s *LocalStorage) putObject(key, contentType string, body io.Reader) (string, error) {
+	objectPath, err := s.resolve("objects", key)
+	if err != nil {
+		return "", err
+	}
+	metaPath, err := s.resolve("meta", key)
+	if err != nil {
+		return "", err
+	}
+
+	sum, size, err := writeFile(objectPath, body)
+	if err != nil {
+		return "", err
+	}
+
+	etag := `"` + sum + `"`
+	if err := writeJSON(metaPath+".json", localMeta{ContentType: contentType, ETag: etag, Size: size}); err != nil {
+		return "", err
+	}
+
+	log.Printf("[Local] 对象已写入: key=%s, size=%d", key, size)
+	return etag, nil
+}
+
+// putPart 写入分片
+func (s *LocalStorage) putPart(key, uploadID string, partNumber int32, body io.Reader) (string, error) {
+	dir, _, err := s.loadUpload(key, uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	sum, _, err := writeFile(filepath.Join(dir, fmt.Sprintf("%05d.part", partNumber)), body)
+	if err != nil {
+		return "", err
+	}
+
+	etag := `"` + sum + `"`
+	if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%05d.etag", partNumber)), []byte(etag), 0644); err != nil {
+		return "", err
+	}
+	return etag, nil
+}
+
+// openObject 打开对象
+func (s *LocalStorage) openObject(key string) (*blobObject, error) {
+	objectPath, err := s.resolve("objects", key)
+	if err != nil {
+		return nil, err
+	}
+	metaPath, err := s.resolve("meta", key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(objectPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var meta localMeta
+	if data, err := os.ReadFile(metaPath + ".json"); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+
+	return &blobObject{
+		Content:     f,
+		ContentType: meta.ContentType,
+		ETag:        meta.ETag,
+		ModTime:     info.ModTime(),
+	}, nil
+}
+
+// GenerateUploadURL 生成上传签名 URL
+func (s *LocalStorage) GenerateUploadURL(key, contentType string, size int64, expiresIn time.Duration) (string, error) {
+	if _, err := s.resolve("objects", key); err != nil {
+		return "", err
+	}
+	params := url.Values{
+		paramContentType:   {contentType},
+		paramContentLength: {strconv.FormatInt(size, 10)},
+	}
+	return s.signer.sign(http.MethodPut, key, params, expiresIn), nil
+}
+
+// GenerateDownloadURL 生成下载签名 URL
+func (s *LocalStorage) GenerateDownloadURL(key, filename string, expiresIn time.Duration) (string, error) {
+	if _, err := s.resolve("objects", key); err != nil {
+		return "", err
+	}
+	params := url.Values{paramFilename: {filename}}
+	return s.signer.sign(http.MethodGet, key, params, expiresIn), nil
+}
+
+// GeneratePreviewURL 生成内联预览签名 URL
+func (s *LocalStorage) GeneratePreviewURL(key, filename, contentType string, expiresIn time.Duration) (string, error) {
+	if _, err := s.resolve("objects", key); err != nil {
+		return "", err
+	}
+	params := url.Values{
+		paramFilename:    {filename},
+		paramContentType: {contentType},
+		paramDisposition: {"inline"},
+	}
+	return s.signer.sign(http.MethodGet, key, params, expiresIn), nil
+}
+
+// PutObject 直接写入对象
+func (s *LocalStorage) PutObject(key, contentType string, body io.ReadSeeker, size int64) (string, error) {
+	return s.putObject(key, contentType, newExactReader(body, size))
+}
+
+// UploadPart 直接写入分片
+func (s *LocalStorage) UploadPart(key, uploadID string, partNumber int32, body io.ReadSeeker, size int64) (string, error) {
+	return s.putPart(key, uploadID, partNumber, newExactReader(body, size))
+}
+
+// InitiateMultipartUpload 初始化分片上传
+func (s *LocalStorage) InitiateMultipartUpload(key, contentType string) (string, error) {
+	if _, err := s.resolve("objects", key); err != nil {
+		return "", err
+	}
+
+	uploadID := uuid.New().String()
+	dir := filepath.Join(s.root, "multipart", uploadID)
+	if err := writeJSON(filepath.Join(dir, "upload.json"), localUpload{
+		Key:         key,
+		ContentType: contentType,
+		Initiated:   time.Now(),
+	}); err != nil {
+		return "", err
+	}
+
+	log.Printf("[Local] 初始化分片上传: key=%s, uploadID=%s", key, uploadID)
+	return uploadID, nil
+}
+
+// GenerateMultipartUploadURL 生成分片上传签名 URL
+func (s *LocalStorage) GenerateMultipartUploadURL(key, uploadID string, partNumber int32, size int64) (string, error) {
+	if _, _, err := s.loadUpload(key, uploadID); err != nil {
+		return "", err
+	}
+	params := url.Values{
+		paramUploadID:      {uploadID},
+		paramPartNumber:    {strconv.Itoa(int(partNumber))},
+		paramContentLength: {strconv.FormatInt(size, 10)},
+	}
+	return s.signer.sign(http.MethodPut, key, params, time.Hour), nil
+}
+
+// ListParts 列出已上传的分片
+func (s *LocalStorage) ListParts(key, uploadID string) ([]Part, error) {
+	dir, _, err := s.loadUpload(key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []Part
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".part") {
+			continue
+		}
+		partNumber, err := strconv.Atoi(strings.TrimSuffix(name, ".part"))
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		etag, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("%05d.etag", partNumber)))
+		if err != nil {
+			continue
+		}
+		parts = append(parts, Part{
+			PartNumber: int32(partNumber),
+			ETag:       string(etag),
+			Size:       info.Size(),
+
+			LastModified: info.ModTime(),
+		})
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// CompleteMultipartUpload 合并分片为最终对象
+func (s *LocalStorage) CompleteMultipartUpload(key, uploadID string, parts []Part) error {
+	log.Printf("[Local] 完成分片上传: key=%s, parts=%d", key, len(parts))
+
+	dir, upload, err := s.loadUpload(key, uploadID)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("分片列表为空")
+	}
+
+	sorted := make([]Part, len(parts))
+	copy(sorted, parts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].PartNumber < sorted[j].PartNumber })
+
+	// 校验分片 ETag 并按顺序拼接
+	paths := make([]string, 0, len(sorted))
+	digests := md5.New()
+	for _, p := range sorted {
+		etag, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("%05d.etag", p.PartNumber)))
+		if err != nil {
+			return fmt.Errorf("分片 %d 不存在", p.PartNumber)
+		}
+		if string(etag) != p.ETag {
+			return fmt.Errorf("分片 %d ETag 不匹配", p.PartNumber)
+		}
+		raw, _ := hex.DecodeString(strings.Trim(string(etag), `"`))
+		digests.Write(raw)
+
+		paths = append(paths, filepath.Join(dir, fmt.Sprintf("%05d.part", p.PartNumber)))
+	}
+
+	objectPath, err := s.resolve("objects", key)
+	if err != nil {
+		return err
+	}
+	metaPath, err := s.resolve("meta", key)
+	if err != nil {
+		return err
+	}
+
+	body := &partFilesReader{paths: paths}
+	defer body.Close()
+
+	_, size, err := writeFile(objectPath, body)
+	if err != nil {
+		return err
+	}
+
+	// 与 S3 一致的分片 ETag 格式: md5(各分片 md5)-分片数
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(digests.Sum(nil)), len(sorted))
+	if err := writeJSON(metaPath+".json", localMeta{ContentType: upload.ContentType, ETag: etag, Size: size}); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// partFilesReader 依次读取分片文件，每个分片读完后立即关闭，同一时间只打开一个文件
+type partFilesReader struct {
+	paths []string
+	cur   *os.File
+}
+
+func (r *partFilesReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.paths) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(r.paths[0])
+			if err != nil {
+				return 0, err
+			}
+			r.cur, r.paths = f, r.paths[1:]
+		}
+
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Close 关闭当前打开的分片文件（读取中途出错时）
+func (r *partFilesReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
+
+// AbortMultipartUpload 终止分片上传并删除已上传的分片
+func (s *LocalStorage) AbortMultipartUpload(key, uploadID string) error {
+	log.Printf("[Local] 终止分片上传: key=%s, uploadID=%s", key, uploadID)
+
+	dir, _, err := s.loadUpload(key, uploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// HeadObject 获取对象元数据
+func (s *LocalStorage) HeadObject(key string) (*ObjectInfo, error) {
+	obj, err := s.openObject(key)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Content.Close()
+
+	size, err := obj.Content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         size,
+		ContentType:  obj.ContentType,
+		LastModified: obj.ModTime,
+	}, nil
+}
+
+// GetObject 读取对象内容
+func (s *LocalStorage) GetObject(key string) (io.ReadCloser, error) {
+	obj, err := s.openObject(key)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Content, nil
+}
+
+// ListMultipartUploads 列出指定前缀下未完成的分片上传
+func (s *LocalStorage) ListMultipartUploads(prefix string) ([]MultipartUploadInfo, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, "multipart"))
+	if err != nil {
+		return nil, err
+	}
+
+	var uploads []MultipartUploadInfo
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.root, "multipart", entry.Name(), "upload.json"))
+		if err != nil {
+			continue
+		}
+		var upload localUpload
+		if err := json.Unmarshal(data, &upload); err != nil || !strings.HasPrefix(upload.Key, prefix) {
+			continue
+		}
+		uploads = append(uploads, MultipartUploadInfo{
+			Key:       upload.Key,
+			UploadID:  entry.Name(),
+			Initiated: upload.Initiated,
+		})
+	}
+
+	return uploads, nil
+}
+
+// ListObjects 列出指定前缀下的全部对象
+func (s *LocalStorage) ListObjects(prefix string) ([]ObjectInfo, error) {
+	base := filepath.Join(s.root, "objects")
+
+	var objects []ObjectInfo
+	err := filepath.WalkDir(base, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// 跳过目录和写入中的临时文件
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// DeleteObject 删除对象（对象不存在时不报错）
+func (s *LocalStorage) DeleteObject(key string) error {
+	log.Printf("[Local] 删除对象: key=%s", key)
+
+	objectPath, err := s.resolve("objects", key)
+	if err != nil {
+		return err
+	}
+	metaPath, err := s.resolve("meta", key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(objectPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(metaPath + ".json"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// TestConnection 测试数据目录是否可写
+func (s *LocalStorage) TestConnection() error {
+	probe := filepath.Join(s.root, ".probe")
+	if err := os.WriteFile(probe, []byte("ok"), 0644); err != nil {
+		return fmt.Errorf("数据目录不可写: %w", err)
+	}
+	return os.Remove(probe)
+}
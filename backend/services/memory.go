@@ -0,0 +1,386 @@
+package services
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStorage 内存存储（用于演示实例和离线模式，进程重启后数据丢失）
+// 上传和下载与本地存储一样通过 r2box 自身的签名 URL 完成
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]*memoryObject
+	uploads map[string]*memoryUpload
+	signer  *urlSigner
+	handler *signedHandler
+}
+
+// memoryObject 内存对象
+type memoryObject struct {
+	data        []byte
+	contentType string
+	etag        string
+	modTime     time.Time
+}
+
+// memoryUpload 内存分片上传
+type memoryUpload struct {
+	key         string
+	contentType string
+	initiated   time.Time
+	parts       map[int32]*memoryPart
+}
+
+// memoryPart 内存分片
+type memoryPart struct {
+	data    []byte
+	etag    string
+	modTime time.Time
+}
+
+// readSeekNopCloser 为 bytes.Reader 补充 Close 方法
+type readSeekNopCloser struct {
+	*bytes.Reader
+}
+
+func (readSeekNopCloser) Close() error { return nil }
+
+// NewMemoryStorage 创建内存存储实例
+func NewMemoryStorage(secret []byte) *MemoryStorage {
+	log.Println("[Memory] 内存存储初始化成功（数据不会持久化）")
+
+	s := &MemoryStorage{
+		objects: make(map[string]*memoryObject),
+		uploads: make(map[string]*memoryUpload),
+		signer:  &urlSigner{secret: secret},
+	}
+	s.handler = &signedHandler{signer: s.signer, store: s}
+	return s
+}
+
+// ServeHTTP 处理签名 URL 的上传和下载
+func (s *MemoryStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// md5ETag 计算 S3 风格的 ETag
+func md5ETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// putObject 写入对象
+func (s *MemoryStorage) putObject(key, contentType string, body io.Reader) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	etag := md5ETag(data)
+
+	s.mu.Lock()
+	s.objects[key] = &memoryObject{
+		data:        data,
+		contentType: contentType,
+		etag:        etag,
+		modTime:     time.Now(),
+	}
+	s.mu.Unlock()
+
+	log.Printf("[Memory] 对象已写入: key=%s, size=%d", key, len(data))
+	return etag, nil
+}
+
+// putPart 写入分片
+func (s *MemoryStorage) putPart(key, uploadID string, partNumber int32, body io.Reader) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, err := s.getUpload(key, uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	etag := md5ETag(data)
+	upload.parts[partNumber] = &memoryPart{data: data, etag: etag, modTime: time.Now()}
+	return etag, nil
+}
+
+// openObject 打开对象
+func (s *MemoryStorage) openObject(key string) (*blobObject, error) {
+	s.mu.RLock()
+	obj, ok := s.objects[key]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+
+	return &blobObject{
+		Content:     readSeekNopCloser{bytes.NewReader(obj.data)},
+		ContentType: obj.contentType,
+		ETag:        obj.etag,
+		ModTime:     obj.modTime,
+	}, nil
+}
+
+// getUpload 获取分片上传（调用方需持有锁）
+func (s *MemoryStorage) getUpload(key, uploadID string) (*memoryUpload, error) {
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.key != key {
+		return nil, fmt.Errorf("分片上传不存在: %w", ErrObjectNotFound)
+	}
+	return upload, nil
+}
+
+// GenerateUploadURL 生成上传签名 URL
+func (s *MemoryStorage) GenerateUploadURL(key, contentType string, size int64, expiresIn time.Duration) (string, error) {
+	params := url.Values{
+		paramContentType:   {contentType},
+		paramContentLength: {strconv.FormatInt(size, 10)},
+	}
+	return s.signer.sign(http.MethodPut, key, params, expiresIn), nil
+}
+
+// GenerateDownloadURL 生成下载签名 URL
+func (s *MemoryStorage) GenerateDownloadURL(key, filename string, expiresIn time.Duration) (string, error) {
+	params := url.Values{paramFilename: {filename}}
+	return s.signer.sign(http.MethodGet, key, params, expiresIn), nil
+}
+
+// GeneratePreviewURL 生成内联预览签名 URL
+func (s *MemoryStorage) GeneratePreviewURL(key, filename, contentType string, expiresIn time.Duration) (string, error) {
+	params := url.Values{
+		paramFilename:    {filename},
+		paramContentType: {contentType},
+		paramDisposition: {"inline"},
+	}
+	return s.signer.sign(http.MethodGet, key, params, expiresIn), nil
+}
+
+// PutObject 直接写入对象
+func (s *MemoryStorage) PutObject(key, contentType string, body io.ReadSeeker, size int64) (string, error) {
+	return s.putObject(key, contentType, newExactReader(body, size))
+}
+
+// UploadPart 直接写入分片
+func (s *MemoryStorage) UploadPart(key, uploadID string, partNumber int32, body io.ReadSeeker, size int64) (string, error) {
+	return s.putPart(key, uploadID, partNumber, newExactReader(body, size))
+}
+
+// InitiateMultipartUpload 初始化分片上传
+func (s *MemoryStorage) InitiateMultipartUpload(key, contentType string) (string, error) {
+	uploadID := uuid.New().String()
+
+	s.mu.Lock()
+	s.uploads[uploadID] = &memoryUpload{
+		key:         key,
+		contentType: contentType,
+		initiated:   time.Now(),
+		parts:       make(map[int32]*memoryPart),
+	}
+	s.mu.Unlock()
+
+	log.Printf("[Memory] 初始化分片上传: key=%s, uploadID=%s", key, uploadID)
+	return uploadID, nil
+}
+
+// GenerateMultipartUploadURL 生成分片上传签名 URL
+func (s *MemoryStorage) GenerateMultipartUploadURL(key, uploadID string, partNumber int32, size int64) (string, error) {
+	s.mu.RLock()
+	_, err := s.getUpload(key, uploadID)
+	s.mu.RUnlock()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		paramUploadID:      {uploadID},
+		paramPartNumber:    {strconv.Itoa(int(partNumber))},
+		paramContentLength: {strconv.FormatInt(size, 10)},
+	}
+	return s.signer.sign(http.MethodPut, key, params, time.Hour), nil
+}
+
+// ListParts 列出已上传的分片
+func (s *MemoryStorage) ListParts(key, uploadID string) ([]Part, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	upload, err := s.getUpload(key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]Part, 0, len(upload.parts))
+	for partNumber, p := range upload.parts {
+		parts = append(parts, Part{
+			PartNumber: partNumber,
+			ETag:       p.etag,
+			Size:       int64(len(p.data)),
+
+			LastModified: p.modTime,
+		})
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// CompleteMultipartUpload 合并分片为最终对象
+func (s *MemoryStorage) CompleteMultipartUpload(key, uploadID string, parts []Part) error {
+	log.Printf("[Memory] 完成分片上传: key=%s, parts=%d", key, len(parts))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, err := s.getUpload(key, uploadID)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("分片列表为空")
+	}
+
+	sorted := make([]Part, len(parts))
+	copy(sorted, parts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].PartNumber < sorted[j].PartNumber })
+
+	var buf bytes.Buffer
+	digests := md5.New()
+	for _, p := range sorted {
+		part, ok := upload.parts[p.PartNumber]
+		if !ok {
+			return fmt.Errorf("分片 %d 不存在", p.PartNumber)
+		}
+		if part.etag != p.ETag {
+			return fmt.Errorf("分片 %d ETag 不匹配", p.PartNumber)
+		}
+		sum := md5.Sum(part.data)
+		digests.Write(sum[:])
+		buf.Write(part.data)
+	}
+
+	s.objects[key] = &memoryObject{
+		data:        buf.Bytes(),
+		contentType: upload.contentType,
+		etag:        fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(digests.Sum(nil)), len(sorted)),
+		modTime:     time.Now(),
+	}
+	delete(s.uploads, uploadID)
+	return nil
+}
+
+// AbortMultipartUpload 终止分片上传
+func (s *MemoryStorage) AbortMultipartUpload(key, uploadID string) error {
+	log.Printf("[Memory] 终止分片上传: key=%s, uploadID=%s", key, uploadID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.getUpload(key, uploadID); err != nil {
+		return err
+	}
+	delete(s.uploads, uploadID)
+	return nil
+}
+
+// HeadObject 获取对象元数据
+func (s *MemoryStorage) HeadObject(key string) (*ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         int64(len(obj.data)),
+		ContentType:  obj.contentType,
+		LastModified: obj.modTime,
+	}, nil
+}
+
+// GetObject 读取对象内容
+func (s *MemoryStorage) GetObject(key string) (io.ReadCloser, error) {
+	obj, err := s.openObject(key)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Content, nil
+}
+
+// ListMultipartUploads 列出指定前缀下未完成的分片上传
+func (s *MemoryStorage) ListMultipartUploads(prefix string) ([]MultipartUploadInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var uploads []MultipartUploadInfo
+	for uploadID, upload := range s.uploads {
+		if !strings.HasPrefix(upload.key, prefix) {
+			continue
+		}
+		uploads = append(uploads, MultipartUploadInfo{
+			Key:       upload.key,
+			UploadID:  uploadID,
+			Initiated: upload.initiated,
+		})
+	}
+	return uploads, nil
+}
+
+// ListObjects 列出指定前缀下的全部对象
+func (s *MemoryStorage) ListObjects(prefix string) ([]ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var objects []ObjectInfo
+	for key, obj := range s.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          key,
+			Size:         int64(len(obj.data)),
+			LastModified: obj.modTime,
+		})
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// DeleteObject 删除对象（对象不存在时不报错）
+func (s *MemoryStorage) DeleteObject(key string) error {
+	log.Printf("[Memory] 删除对象: key=%s", key)
+
+	s.mu.Lock()
+	delete(s.objects, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// TestConnection 内存存储始终可用
+func (s *MemoryStorage) TestConnection() error {
+	return nil
+}
@@ -0,0 +1,76 @@
+package services
+
+import "fmt"
+
+// S3/R2 分片上传限制
+const (
+	MaxPartCount   = 10000                  // 单次分片上传最多分片数
+	MinPartSize    = 5 * 1024 * 1024        // 除最后一个分片外的最小分片大小
+	MaxPartSizeCap = 5 * 1024 * 1024 * 1024 // 单个分片的最大大小
+)
+
+// partAlign 分片大小按 1MB 对齐
+const partAlign = 1024 * 1024
+
+// PartSizer 根据文件大小计算分片布局
+type PartSizer struct {
+	MinPartSize int64 // 最小分片大小
+	MaxPartSize int64 // 最大分片大小
+	TargetParts int   // 期望的分片数，文件越大分片越大，分片数尽量不超过该值
+}
+
+// PartLayout 分片布局
+type PartLayout struct {
+	PartSize     int64 `json:"part_size"`
+	TotalParts   int   `json:"total_parts"`
+	LastPartSize int64 `json:"last_part_size"`
+}
+
+// Plan 计算分片布局：分片大小取 size/TargetParts 并按 1MB 向上对齐，再限制在 [MinPartSize, MaxPartSize] 内
+// 按最大分片仍超过 MaxPartCount 个分片时返回错误
+func (p PartSizer) Plan(size int64) (*PartLayout, error) {
+	minSize, maxSize, target := p.limits()
+
+	partSize := ceilDiv(ceilDiv(size, int64(target)), partAlign) * partAlign
+	if partSize < minSize {
+		partSize = minSize
+	}
+	if partSize > maxSize {
+		partSize = maxSize
+	}
+
+	totalParts := ceilDiv(size, partSize)
+	if totalParts > MaxPartCount {
+		return nil, fmt.Errorf("文件过大: 按最大分片 %d 字节需要 %d 个分片，超过 %d 个的上限", maxSize, totalParts, MaxPartCount)
+	}
+
+	layout := &PartLayout{PartSize: partSize, TotalParts: int(totalParts)}
+	if totalParts > 0 {
+		layout.LastPartSize = size - (totalParts-1)*partSize
+	}
+	return layout, nil
+}
+
+// limits 规范化配置，保证不超出 S3/R2 的限制
+func (p PartSizer) limits() (minSize, maxSize int64, target int) {
+	minSize, maxSize, target = p.MinPartSize, p.MaxPartSize, p.TargetParts
+
+	if minSize < MinPartSize {
+		minSize = MinPartSize
+	}
+	if maxSize <= 0 || maxSize > MaxPartSizeCap {
+		maxSize = MaxPartSizeCap
+	}
+	if maxSize < minSize {
+		maxSize = minSize
+	}
+	if target <= 0 || target > MaxPartCount {
+		target = MaxPartCount
+	}
+	return minSize, maxSize, target
+}
+
+// ceilDiv 向上取整除法
+func ceilDiv(a, b int64) int64 {
+	return (a + b - 1) / b
+}
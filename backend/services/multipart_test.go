@@ -0,0 +1,98 @@
+package services
+
+import "testing"
+
+func TestPartSizerPlan(t *testing.T) {
+	const mb = int64(1024 * 1024)
+	const gb = 1024 * mb
+
+	tests := []struct {
+		name    string
+		sizer   PartSizer
+		size    int64
+		want    PartLayout
+		wantErr bool
+	}{
+		{
+			name:  "小文件使用最小分片",
+			sizer: PartSizer{TargetParts: 1000},
+			size:  12 * mb,
+			want:  PartLayout{PartSize: 5 * mb, TotalParts: 3, LastPartSize: 2 * mb},
+		},
+		{
+			name:  "恰好整除",
+			sizer: PartSizer{TargetParts: 1000},
+			size:  10 * mb,
+			want:  PartLayout{PartSize: 5 * mb, TotalParts: 2, LastPartSize: 5 * mb},
+		},
+		{
+			name:  "按 1MB 向上对齐",
+			sizer: PartSizer{TargetParts: 1000},
+			size:  10*gb + 1,
+			want:  PartLayout{PartSize: 11 * mb, TotalParts: 931, LastPartSize: 10*gb + 1 - 930*11*mb},
+		},
+		{
+			name:  "配置的最小分片低于 S3 下限时按 5MB 计算",
+			sizer: PartSizer{MinPartSize: mb, TargetParts: 1000},
+			size:  6 * mb,
+			want:  PartLayout{PartSize: 5 * mb, TotalParts: 2, LastPartSize: mb},
+		},
+		{
+			name:  "限制在最大分片内",
+			sizer: PartSizer{MaxPartSize: 8 * mb, TargetParts: 10},
+			size:  100 * mb,
+			want:  PartLayout{PartSize: 8 * mb, TotalParts: 13, LastPartSize: 4 * mb},
+		},
+		{
+			name:  "最大分片小于最小分片时取最小分片",
+			sizer: PartSizer{MinPartSize: 16 * mb, MaxPartSize: 8 * mb, TargetParts: 10},
+			size:  100 * mb,
+			want:  PartLayout{PartSize: 16 * mb, TotalParts: 7, LastPartSize: 4 * mb},
+		},
+		{
+			name:  "未配置时按 10000 个分片计算",
+			sizer: PartSizer{},
+			size:  100 * gb,
+			want:  PartLayout{PartSize: 11 * mb, TotalParts: 9310, LastPartSize: 100*gb - 9309*11*mb},
+		},
+		{
+			name:  "恰好 10000 个最大分片",
+			sizer: PartSizer{MaxPartSize: 5 * mb},
+			size:  MaxPartCount * 5 * mb,
+			want:  PartLayout{PartSize: 5 * mb, TotalParts: MaxPartCount, LastPartSize: 5 * mb},
+		},
+		{
+			name:    "超过 10000 个分片",
+			sizer:   PartSizer{MaxPartSize: 5 * mb},
+			size:    MaxPartCount*5*mb + 1,
+			wantErr: true,
+		},
+		{
+			name:    "超过 S3 上限",
+			sizer:   PartSizer{},
+			size:    MaxPartCount*MaxPartSizeCap + 1,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := tt.sizer.Plan(tt.size)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Plan(%d) = %+v, 期望返回错误", tt.size, layout)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Plan(%d) 失败: %v", tt.size, err)
+			}
+			if *layout != tt.want {
+				t.Fatalf("Plan(%d) = %+v, 期望 %+v", tt.size, *layout, tt.want)
+			}
+			if layout.PartSize%partAlign != 0 {
+				t.Fatalf("分片大小 %d 未按 1MB 对齐", layout.PartSize)
+			}
+		})
+	}
+}
@@ -3,8 +3,11 @@ package services
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -117,15 +120,17 @@ func createS3Client(r2Config *R2Config) (*s3.Client, error) {
 }
 
 // GenerateUploadURL 生成上传预签名 URL
-func (s *R2Service) GenerateUploadURL(key, contentType string, expiresIn time.Duration) (string, error) {
-	log.Printf("[R2] 生成上传 URL: key=%s, contentType=%s", key, contentType)
+// R2 不支持 POST 策略上传，因此将 Content-Length 签入 PUT 请求来约束上传大小
+func (s *R2Service) GenerateUploadURL(key, contentType string, size int64, expiresIn time.Duration) (string, error) {
+	log.Printf("[R2] 生成上传 URL: key=%s, contentType=%s, size=%d", key, contentType, size)
 
 	presignClient := s3.NewPresignClient(s.client)
 
 	req, err := presignClient.PresignPutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucketName),
-		Key:         aws.String(key),
-		ContentType: aws.String(contentType),
+		Bucket:        aws.String(s.bucketName),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
 	}, func(opts *s3.PresignOptions) {
 		opts.Expires = expiresIn
 	})
@@ -164,6 +169,29 @@ func (s *R2Service) GenerateDownloadURL(key, filename string, expiresIn time.Dur
 	return req.URL, nil
 }
 
+// GeneratePreviewURL 生成内联预览预签名 URL
+func (s *R2Service) GeneratePreviewURL(key, filename, contentType string, expiresIn time.Duration) (string, error) {
+	log.Printf("[R2] 生成预览 URL: key=%s, filename=%s", key, filename)
+
+	presignClient := s3.NewPresignClient(s.client)
+
+	req, err := presignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket:                     aws.String(s.bucketName),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(mime.FormatMediaType("inline", map[string]string{"filename": filename})),
+		ResponseContentType:        aws.String(contentType),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = expiresIn
+	})
+
+	if err != nil {
+		log.Printf("[R2] 生成预览 URL 失败: %v", err)
+		return "", err
+	}
+
+	return req.URL, nil
+}
+
 // InitiateMultipartUpload 初始化分片上传
 func (s *R2Service) InitiateMultipartUpload(key, contentType string) (string, error) {
 	log.Printf("[R2] 初始化分片上传: key=%s", key)
@@ -183,14 +211,15 @@ func (s *R2Service) InitiateMultipartUpload(key, contentType string) (string, er
 }
 
 // GenerateMultipartUploadURL 生成分片上传预签名 URL
-func (s *R2Service) GenerateMultipartUploadURL(key, uploadID string, partNumber int32) (string, error) {
+func (s *R2Service) GenerateMultipartUploadURL(key, uploadID string, partNumber int32, size int64) (string, error) {
 	presignClient := s3.NewPresignClient(s.client)
 
 	req, err := presignClient.PresignUploadPart(context.TODO(), &s3.UploadPartInput{
-		Bucket:     aws.String(s.bucketName),
-		Key:        aws.String(key),
-		UploadId:   aws.String(uploadID),
-		PartNumber: aws.Int32(partNumber),
+		Bucket:        aws.String(s.bucketName),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(partNumber),
+		ContentLength: aws.Int64(size),
 	}, func(opts *s3.PresignOptions) {
 		opts.Expires = time.Hour
 	})
@@ -204,15 +233,23 @@ func (s *R2Service) GenerateMultipartUploadURL(key, uploadID string, partNumber
 }
 
 // CompleteMultipartUpload 完成分片上传
-func (s *R2Service) CompleteMultipartUpload(key, uploadID string, parts []types.CompletedPart) error {
+func (s *R2Service) CompleteMultipartUpload(key, uploadID string, parts []Part) error {
 	log.Printf("[R2] 完成分片上传: key=%s, parts=%d", key, len(parts))
 
+	completedParts := make([]types.CompletedPart, len(parts))
+	for i, p := range parts {
+		completedParts[i] = types.CompletedPart{
+			PartNumber: aws.Int32(p.PartNumber),
+			ETag:       aws.String(p.ETag),
+		}
+	}
+
 	_, err := s.client.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
 		Bucket:   aws.String(s.bucketName),
 		Key:      aws.String(key),
 		UploadId: aws.String(uploadID),
 		MultipartUpload: &types.CompletedMultipartUpload{
-			Parts: parts,
+			Parts: completedParts,
 		},
 	})
 
@@ -223,19 +260,147 @@ func (s *R2Service) CompleteMultipartUpload(key, uploadID string, parts []types.
 	return err
 }
 
+// PutObject 直接上传对象
+func (s *R2Service) PutObject(key, contentType string, body io.ReadSeeker, size int64) (string, error) {
+	output, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucketName),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	})
+
+	if err != nil {
+		log.Printf("[R2] 上传对象失败: key=%s, %v", key, err)
+		return "", err
+	}
+
+	log.Printf("[R2] 对象已上传: key=%s, size=%d", key, size)
+	return aws.ToString(output.ETag), nil
+}
+
+// UploadPart 直接上传分片
+func (s *R2Service) UploadPart(key, uploadID string, partNumber int32, body io.ReadSeeker, size int64) (string, error) {
+	output, err := s.client.UploadPart(context.TODO(), &s3.UploadPartInput{
+		Bucket:        aws.String(s.bucketName),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(partNumber),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+
+	if err != nil {
+		log.Printf("[R2] 上传分片失败: key=%s, part=%d, %v", key, partNumber, err)
+		return "", err
+	}
+
+	return aws.ToString(output.ETag), nil
+}
+
 // ListParts 列出已上传的分片
-func (s *R2Service) ListParts(key, uploadID string) ([]types.Part, error) {
-	output, err := s.client.ListParts(context.TODO(), &s3.ListPartsInput{
+func (s *R2Service) ListParts(key, uploadID string) ([]Part, error) {
+	input := &s3.ListPartsInput{
 		Bucket:   aws.String(s.bucketName),
 		Key:      aws.String(key),
 		UploadId: aws.String(uploadID),
+	}
+
+	// 每页最多 1000 个分片，需要按 PartNumberMarker 翻页
+	var parts []Part
+	for {
+		output, err := s.client.ListParts(context.TODO(), input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range output.Parts {
+			parts = append(parts, Part{
+				PartNumber: aws.ToInt32(p.PartNumber),
+				ETag:       aws.ToString(p.ETag),
+				Size:       aws.ToInt64(p.Size),
+
+				LastModified: aws.ToTime(p.LastModified),
+			})
+		}
+
+		if !aws.ToBool(output.IsTruncated) {
+			break
+		}
+		input.PartNumberMarker = output.NextPartNumberMarker
+	}
+
+	return parts, nil
+}
+
+// HeadObject 获取对象元数据
+func (s *R2Service) HeadObject(key string) (*ObjectInfo, error) {
+	output, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
 	})
 
 	if err != nil {
+		var notFound *types.NotFound
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &notFound) || errors.As(err, &noSuchKey) {
+			return nil, ErrObjectNotFound
+		}
+		log.Printf("[R2] 获取对象元数据失败: %v", err)
 		return nil, err
 	}
 
-	return output.Parts, nil
+	return &ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(output.ContentLength),
+		ContentType:  aws.ToString(output.ContentType),
+		LastModified: aws.ToTime(output.LastModified),
+	}, nil
+}
+
+// GetObject 读取对象内容
+func (s *R2Service) GetObject(key string) (io.ReadCloser, error) {
+	output, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrObjectNotFound
+		}
+		log.Printf("[R2] 读取对象失败: %v", err)
+		return nil, err
+	}
+
+	return output.Body, nil
+}
+
+// ListObjects 分页列出指定前缀下的全部对象
+func (s *R2Service) ListObjects(prefix string) ([]ObjectInfo, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	var objects []ObjectInfo
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			log.Printf("[R2] 列出对象失败: %v", err)
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
 }
 
 // DeleteObject 删除对象
@@ -273,6 +438,39 @@ func (s *R2Service) AbortMultipartUpload(key, uploadID string) error {
 	return nil
 }
 
+// ListMultipartUploads 分页列出指定前缀下未完成的分片上传
+func (s *R2Service) ListMultipartUploads(prefix string) ([]MultipartUploadInfo, error) {
+	input := &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	}
+
+	var uploads []MultipartUploadInfo
+	for {
+		output, err := s.client.ListMultipartUploads(context.TODO(), input)
+		if err != nil {
+			log.Printf("[R2] 列出分片上传失败: %v", err)
+			return nil, err
+		}
+
+		for _, u := range output.Uploads {
+			uploads = append(uploads, MultipartUploadInfo{
+				Key:       aws.ToString(u.Key),
+				UploadID:  aws.ToString(u.UploadId),
+				Initiated: aws.ToTime(u.Initiated),
+			})
+		}
+
+		if !aws.ToBool(output.IsTruncated) {
+			break
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.UploadIdMarker = output.NextUploadIdMarker
+	}
+
+	return uploads, nil
+}
+
 // TestConnection 测试 R2 连接
 func (s *R2Service) TestConnection() error {
 	log.Printf("[R2] 测试连接: bucket=%s", s.bucketName)
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"r2box/models"
+	"sync"
+	"time"
+)
+
+// ReapedUpload 已终止的分片上传
+type ReapedUpload struct {
+	Key       string    `json:"key"`
+	UploadID  string    `json:"upload_id"`
+	Initiated time.Time `json:"initiated"`
+}
+
+// ReapedRecord 已删除的未完成记录
+type ReapedRecord struct {
+	ID           string    `json:"id"`
+	Filename     string    `json:"filename"`
+	Size         int64     `json:"size"`
+	UploadStatus string    `json:"upload_status"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ReapReport 清理报告
+type ReapReport struct {
+	StartedAt      time.Time      `json:"started_at"`
+	MaxAge         string         `json:"max_age"`
+	AbortedUploads []ReapedUpload `json:"aborted_uploads"`
+	DeletedRecords []ReapedRecord `json:"deleted_records"`
+	ReleasedBytes  int64          `json:"released_bytes"`
+	Errors         []string       `json:"errors,omitempty"`
+}
+
+// Reaper 清理被放弃的分片上传和长期未确认的上传记录
+// 是否被放弃按最近活动时间（最近写入的分片或 tus 缓冲区）判断，而不是发起时间，仍在上传的大文件不会被终止
+type Reaper struct {
+	db     *sql.DB
+	maxAge time.Duration
+	buffer *ChunkBuffer
+
+	mu   sync.Mutex
+	last *ReapReport
+}
+
+// NewReaper 创建清理器，buffer 为 tus 上传的分块缓冲区（可为 nil）
+func NewReaper(db *sql.DB, maxAge time.Duration, buffer *ChunkBuffer) *Reaper {
+	return &Reaper{
+		db:     db,
+		maxAge: maxAge,
+		buffer: buffer,
+	}
+}
+
+// LastReport 获取最近一次清理报告（尚未执行时返回 nil）
+func (r *Reaper) LastReport() *ReapReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// Run 执行一次清理
+// 1. 终止超过 maxAge 没有活动的分片上传（未完成的分片同样占用存储）
+// 2. 删除超过 maxAge 没有活动仍处于 pending/uploading 的记录及可能已写入的对象
+func (r *Reaper) Run(storage Storage) *ReapReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-r.maxAge)
+	report := &ReapReport{
+		StartedAt:      now,
+		MaxAge:         r.maxAge.String(),
+		AbortedUploads: []ReapedUpload{},
+		DeletedRecords: []ReapedRecord{},
+	}
+
+	// 创建时间早于 cutoff 的未完成记录，按最近活动时间筛选
+	files, err := models.GetStaleUploads(r.db, cutoff)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("获取未完成记录失败: %v", err))
+	}
+	activity := make(map[string]time.Time, len(files))
+	byUploadID := make(map[string]string, len(files))
+	for _, f := range files {
+		activity[f.ID] = r.lastActivity(storage, &f)
+		if f.UploadID != "" {
+			byUploadID[f.UploadID] = f.ID
+		}
+	}
+
+	uploads, err := storage.ListMultipartUploads(models.R2KeyPrefix)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("列出分片上传失败: %v", err))
+	}
+	for _, u := range uploads {
+		if !u.Initiated.Before(cutoff) {
+			continue
+		}
+		// 有记录的上传以记录的活动时间为准，没有记录的上传以存储中最近写入的分片为准
+		last, tracked := activity[byUploadID[u.UploadID]]
+		if !tracked {
+			last = latestPart(storage, u.Key, u.UploadID, u.Initiated)
+		}
+		if !last.Before(cutoff) {
+			continue
+		}
+		if err := storage.AbortMultipartUpload(u.Key, u.UploadID); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("终止分片上传 %s 失败: %v", u.UploadID, err))
+			continue
+		}
+		report.AbortedUploads = append(report.AbortedUploads, ReapedUpload{
+			Key:       u.Key,
+			UploadID:  u.UploadID,
+			Initiated: u.Initiated,
+		})
+	}
+
+	for _, f := range files {
+		if !activity[f.ID].Before(cutoff) {
+			continue
+		}
+		// 小文件可能已经 PUT 成功但未确认
+		if err := storage.DeleteObject(f.R2Key); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("删除对象 %s 失败: %v", f.R2Key, err))
+			continue
+		}
+		if err := models.DeleteFile(r.db, f.ID); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("删除记录 %s 失败: %v", f.ID, err))
+			continue
+		}
+		report.DeletedRecords = append(report.DeletedRecords, ReapedRecord{
+			ID:           f.ID,
+			Filename:     f.Filename,
+			Size:         f.Size,
+			UploadStatus: f.UploadStatus,
+			CreatedAt:    f.CreatedAt,
+		})
+		report.ReleasedBytes += f.Size
+	}
+
+	if len(report.AbortedUploads) > 0 || len(report.DeletedRecords) > 0 || len(report.Errors) > 0 {
+		log.Printf("[Reaper] 清理完成: 终止分片上传=%d, 删除记录=%d, 释放=%d 字节, 错误=%d",
+			len(report.AbortedUploads), len(report.DeletedRecords), report.ReleasedBytes, len(report.Errors))
+	}
+
+	r.last = report
+	return report
+}
+
+// lastActivity 上传记录的最近活动时间：创建时间、分片记录、存储中的分片和 tus 缓冲区中最晚的一个
+func (r *Reaper) lastActivity(storage Storage, f *models.File) time.Time {
+	last, err := f.LastActivity(r.db)
+	if err != nil {
+		log.Printf("[Reaper] 读取分片记录失败: file_id=%s, %v", f.ID, err)
+	}
+	if f.UploadID != "" {
+		last = latestPart(storage, f.R2Key, f.UploadID, last)
+	}
+	if r.buffer != nil {
+		if modTime, err := r.buffer.ModTime(f.ID); err == nil && modTime.After(last) {
+			last = modTime
+		}
+	}
+	return last
+}
+
+// latestPart 返回存储中最近写入的分片时间，没有更晚的分片（或列出失败）时返回 since
+func latestPart(storage Storage, key, uploadID string, since time.Time) time.Time {
+	parts, err := storage.ListParts(key, uploadID)
+	if err != nil {
+		return since
+	}
+	for _, p := range parts {
+		if p.LastModified.After(since) {
+			since = p.LastModified
+		}
+	}
+	return since
+}
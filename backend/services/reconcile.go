@@ -0,0 +1,119 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"r2box/models"
+)
+
+// ReconcileOptions 对账选项
+type ReconcileOptions struct {
+	DeleteOrphans bool `json:"delete_orphans"` // 删除没有有效记录的孤儿对象
+	MarkMissing   bool `json:"mark_missing"`   // 将对象已丢失的已完成记录标记为 missing
+}
+
+// DryRun 是否只报告不修改
+func (o ReconcileOptions) DryRun() bool {
+	return !o.DeleteOrphans && !o.MarkMissing
+}
+
+// MissingRecord 对象已丢失的文件记录
+type MissingRecord struct {
+	ID        string `json:"id"`
+	Filename  string `json:"filename"`
+	R2Key     string `json:"r2_key"`
+	ShortCode string `json:"short_code"`
+}
+
+// ReconcileReport 对账报告
+type ReconcileReport struct {
+	DryRun         bool            `json:"dry_run"`
+	ScannedObjects int             `json:"scanned_objects"`
+	ScannedRecords int             `json:"scanned_records"`
+	OrphanObjects  []ObjectInfo    `json:"orphan_objects"`
+	OrphanBytes    int64           `json:"orphan_bytes"`
+	MissingRecords []MissingRecord `json:"missing_records"`
+	DeletedOrphans int             `json:"deleted_orphans"`
+	MarkedMissing  int             `json:"marked_missing"`
+	Errors         []string        `json:"errors,omitempty"`
+}
+
+// Reconcile 对比存储桶中 r2box/ 前缀下的对象与 files 表
+// 孤儿对象：没有记录，或记录已标记为 deleted/cancelled 的对象
+// 丢失记录：状态为 completed 但对象不存在的记录
+func Reconcile(db *sql.DB, storage Storage, opts ReconcileOptions) (*ReconcileReport, error) {
+	log.Printf("[Reconcile] 开始对账: delete_orphans=%v, mark_missing=%v", opts.DeleteOrphans, opts.MarkMissing)
+
+	objects, err := storage.ListObjects(models.R2KeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("列出对象失败: %w", err)
+	}
+
+	files, err := models.GetFilesByR2KeyPrefix(db, models.R2KeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("获取文件记录失败: %w", err)
+	}
+
+	report := &ReconcileReport{
+		DryRun:         opts.DryRun(),
+		ScannedObjects: len(objects),
+		ScannedRecords: len(files),
+		OrphanObjects:  []ObjectInfo{},
+		MissingRecords: []MissingRecord{},
+	}
+
+	records := make(map[string]models.File, len(files))
+	for _, f := range files {
+		records[f.R2Key] = f
+	}
+
+	existing := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		existing[obj.Key] = true
+
+		f, ok := records[obj.Key]
+		if ok && f.UploadStatus != "deleted" && f.UploadStatus != "cancelled" {
+			continue
+		}
+
+		report.OrphanObjects = append(report.OrphanObjects, obj)
+		report.OrphanBytes += obj.Size
+
+		if opts.DeleteOrphans {
+			if err := storage.DeleteObject(obj.Key); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("删除孤儿对象 %s 失败: %v", obj.Key, err))
+				continue
+			}
+			report.DeletedOrphans++
+		}
+	}
+
+	for _, f := range files {
+		if f.UploadStatus != "completed" || existing[f.R2Key] {
+			continue
+		}
+
+		report.MissingRecords = append(report.MissingRecords, MissingRecord{
+			ID:        f.ID,
+			Filename:  f.Filename,
+			R2Key:     f.R2Key,
+			ShortCode: f.ShortCode,
+		})
+
+		if opts.MarkMissing {
+			file := f
+			if err := file.UpdateStatus(db, "missing"); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("标记记录 %s 失败: %v", f.ID, err))
+				continue
+			}
+			report.MarkedMissing++
+		}
+	}
+
+	log.Printf("[Reconcile] 对账完成: 对象=%d, 记录=%d, 孤儿对象=%d, 丢失记录=%d, 已删除=%d, 已标记=%d",
+		report.ScannedObjects, report.ScannedRecords, len(report.OrphanObjects), len(report.MissingRecords),
+		report.DeletedOrphans, report.MarkedMissing)
+
+	return report, nil
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignedURLPrefix 自托管后端的签名 URL 路径前缀（由 r2box 自身提供上传/下载）
+const SignedURLPrefix = "/api/storage/"
+
+// 签名 URL 查询参数
+const (
+	paramExpires       = "X-R2Box-Expires"
+	paramSignature     = "X-R2Box-Signature"
+	paramContentType   = "content-type"
+	paramContentLength = "content-length"
+	paramFilename      = "filename"
+	paramDisposition   = "disposition"
+	paramUploadID      = "uploadId"
+	paramPartNumber    = "partNumber"
+)
+
+// ErrObjectNotFound 对象不存在
+var ErrObjectNotFound = errors.New("对象不存在")
+
+// blobObject 可读取的对象
+type blobObject struct {
+	Content     io.ReadSeekCloser
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// blobStore 自托管后端的底层读写接口，由 signedHandler 通过 HTTP 暴露
+type blobStore interface {
+	putObject(key, contentType string, body io.Reader) (etag string, err error)
+	putPart(key, uploadID string, partNumber int32, body io.Reader) (etag string, err error)
+	openObject(key string) (*blobObject, error)
+}
+
+// urlSigner 使用 HMAC-SHA256 生成和校验带过期时间的 r2box 签名 URL
+type urlSigner struct {
+	secret []byte
+}
+
+// signature 计算签名（覆盖请求方法、对象 key 和除签名外的全部查询参数）
+func (s *urlSigner) signature(method, key string, params url.Values) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(method + "\n" + key + "\n" + params.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sign 生成签名 URL
+func (s *urlSigner) sign(method, key string, params url.Values, expiresIn time.Duration) string {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set(paramExpires, strconv.FormatInt(time.Now().Add(expiresIn).Unix(), 10))
+	params.Set(paramSignature, s.signature(method, key, params))
+
+	u := url.URL{Path: SignedURLPrefix + key, RawQuery: params.Encode()}
+	return u.String()
+}
+
+// verify 校验签名和过期时间
+func (s *urlSigner) verify(method, key string, query url.Values) error {
+	expires, err := strconv.ParseInt(query.Get(paramExpires), 10, 64)
+	if err != nil {
+		return fmt.Errorf("缺少过期时间")
+	}
+	if time.Now().Unix() > expires {
+		return fmt.Errorf("签名已过期")
+	}
+
+	params := url.Values{}
+	for k, v := range query {
+		if k != paramSignature {
+			params[k] = v
+		}
+	}
+
+	expected := s.signature(method, key, params)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(query.Get(paramSignature))) != 1 {
+		return fmt.Errorf("签名无效")
+	}
+	return nil
+}
+
+// LoadSigningSecret 获取签名密钥：优先使用配置值，否则从数据库读取，不存在时自动生成并保存
+func LoadSigningSecret(db *sql.DB, configured string) ([]byte, error) {
+	if configured != "" {
+		return []byte(configured), nil
+	}
+
+	var secret string
+	err := db.QueryRow("SELECT value FROM system_config WHERE key = 'storage_signing_secret'").Scan(&secret)
+	if err == nil && secret != "" {
+		return []byte(secret), nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	secret = hex.EncodeToString(buf)
+
+	_, err = db.Exec(`
+		INSERT INTO system_config (key, value, updated_at)
+		VALUES ('storage_signing_secret', ?, CURRENT_TIMESTAMP)
+	`, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("[Storage] 已生成新的签名密钥")
+	return []byte(secret), nil
+}
+
+// signedHandler 处理签名 URL 的上传和下载请求
+type signedHandler struct {
+	signer *urlSigner
+	store  blobStore
+}
+
+// ServeHTTP 处理 /api/storage/{key} 请求
+func (h *signedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, SignedURLPrefix)
+	if key == "" || key == r.URL.Path {
+		http.Error(w, "无效的对象路径", http.StatusBadRequest)
+		return
+	}
+
+	// HEAD 请求使用 GET 签名
+	method := r.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	query := r.URL.Query()
+	if err := h.signer.verify(method, key, query); err != nil {
+		log.Printf("[Storage] 签名校验失败: key=%s, %v", key, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	switch method {
+	case http.MethodPut:
+		h.handlePut(w, r, key, query)
+	case http.MethodGet:
+		h.handleGet(w, r, key, query)
+	default:
+		http.Error(w, "方法不允许", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePut 处理对象或分片上传
+func (h *signedHandler) handlePut(w http.ResponseWriter, r *http.Request, key string, query url.Values) {
+	defer r.Body.Close()
+
+	// 请求体大小必须与签名中的 Content-Length 一致
+	var body io.Reader = r.Body
+	if signedLength := query.Get(paramContentLength); signedLength != "" {
+		size, err := strconv.ParseInt(signedLength, 10, 64)
+		if err != nil {
+			http.Error(w, "无效的 Content-Length 签名", http.StatusBadRequest)
+			return
+		}
+		if r.ContentLength < 0 {
+			http.Error(w, "缺少 Content-Length", http.StatusLengthRequired)
+			return
+		}
+		if r.ContentLength != size {
+			http.Error(w, "Content-Length 与签名不一致", http.StatusForbidden)
+			return
+		}
+		body = newExactReader(r.Body, size)
+	}
+
+	var etag string
+	var err error
+
+	if uploadID := query.Get(paramUploadID); uploadID != "" {
+		partNumber, perr := strconv.ParseInt(query.Get(paramPartNumber), 10, 32)
+		if perr != nil || partNumber < 1 {
+			http.Error(w, "无效的分片编号", http.StatusBadRequest)
+			return
+		}
+		etag, err = h.store.putPart(key, uploadID, int32(partNumber), body)
+	} else {
+		etag, err = h.store.putObject(key, query.Get(paramContentType), body)
+	}
+
+	if err != nil {
+		log.Printf("[Storage] 写入失败: key=%s, %v", key, err)
+		if errors.Is(err, ErrObjectNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "写入失败", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGet 处理对象下载
+func (h *signedHandler) handleGet(w http.ResponseWriter, r *http.Request, key string, query url.Values) {
+	obj, err := h.store.openObject(key)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("[Storage] 读取失败: key=%s, %v", key, err)
+		http.Error(w, "读取失败", http.StatusInternalServerError)
+		return
+	}
+	defer obj.Content.Close()
+
+	// 预览 URL 签入了响应类型，与 S3 的 response-content-type 一致
+	contentType := obj.ContentType
+	if override := query.Get(paramContentType); override != "" {
+		contentType = override
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if obj.ETag != "" {
+		w.Header().Set("ETag", obj.ETag)
+	}
+	disposition := "attachment"
+	if query.Get(paramDisposition) == "inline" {
+		disposition = "inline"
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	if filename := query.Get(paramFilename); filename != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	}
+
+	http.ServeContent(w, r, "", obj.ModTime, obj.Content)
+}
+
+// errBodyTooLong 写入的内容超过声明的大小
+var errBodyTooLong = errors.New("内容长度超过声明的大小")
+
+// exactReader 读取恰好 remaining 字节，提前结束时返回 io.ErrUnexpectedEOF，超出时返回 errBodyTooLong
+type exactReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+// newExactReader 要求 r 恰好包含 size 字节（多读取一个字节用于发现超出的内容）
+func newExactReader(r io.Reader, size int64) io.Reader {
+	return &exactReader{r: io.LimitReader(r, size+1), remaining: size}
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	e.remaining -= int64(n)
+	if e.remaining < 0 {
+		return n, errBodyTooLong
+	}
+	if err == io.EOF && e.remaining > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
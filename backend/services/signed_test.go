@@ -0,0 +1,130 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseSigned 拆出签名 URL 中的对象 key 和查询参数
+func parseSigned(t *testing.T, raw string) (string, url.Values) {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("解析签名 URL 失败: %v", err)
+	}
+	if !strings.HasPrefix(u.Path, SignedURLPrefix) {
+		t.Fatalf("签名 URL 路径 %q 缺少前缀 %q", u.Path, SignedURLPrefix)
+	}
+	return strings.TrimPrefix(u.Path, SignedURLPrefix), u.Query()
+}
+
+func TestURLSignerVerify(t *testing.T) {
+	signer := &urlSigner{secret: []byte("secret")}
+
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		mutate    func(method, key *string, query url.Values)
+		wantErr   bool
+	}{
+		{name: "有效", expiresIn: time.Minute},
+		{name: "已过期", expiresIn: -time.Minute, wantErr: true},
+		{
+			name:      "方法不同",
+			expiresIn: time.Minute,
+			mutate:    func(method, _ *string, _ url.Values) { *method = "GET" },
+			wantErr:   true,
+		},
+		{
+			name:      "key 不同",
+			expiresIn: time.Minute,
+			mutate:    func(_, key *string, _ url.Values) { *key = "uploads/other" },
+			wantErr:   true,
+		},
+		{
+			name:      "篡改签名参数",
+			expiresIn: time.Minute,
+			mutate:    func(_, _ *string, q url.Values) { q.Set(paramContentLength, "999999") },
+			wantErr:   true,
+		},
+		{
+			name:      "延长过期时间",
+			expiresIn: time.Minute,
+			mutate: func(_, _ *string, q url.Values) {
+				q.Set(paramExpires, "99999999999")
+			},
+			wantErr: true,
+		},
+		{
+			name:      "缺少过期时间",
+			expiresIn: time.Minute,
+			mutate:    func(_, _ *string, q url.Values) { q.Del(paramExpires) },
+			wantErr:   true,
+		},
+		{
+			name:      "缺少签名",
+			expiresIn: time.Minute,
+			mutate:    func(_, _ *string, q url.Values) { q.Del(paramSignature) },
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := url.Values{paramContentLength: {"10"}}
+			key, query := parseSigned(t, signer.sign("PUT", "uploads/a.txt", params, tt.expiresIn))
+			if key != "uploads/a.txt" {
+				t.Fatalf("key = %q, 期望 uploads/a.txt", key)
+			}
+
+			method := "PUT"
+			if tt.mutate != nil {
+				tt.mutate(&method, &key, query)
+			}
+			err := signer.verify(method, key, query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verify() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestURLSignerDifferentSecret(t *testing.T) {
+	a := &urlSigner{secret: []byte("a")}
+	b := &urlSigner{secret: []byte("b")}
+
+	key, query := parseSigned(t, a.sign("GET", "uploads/a.txt", nil, time.Minute))
+	if err := b.verify("GET", key, query); err == nil {
+		t.Fatal("其他密钥签发的 URL 不应通过校验")
+	}
+}
+
+func TestExactReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		size    int64
+		wantErr error
+	}{
+		{name: "大小一致", body: "hello", size: 5},
+		{name: "空内容", body: "", size: 0},
+		{name: "内容过短", body: "hell", size: 5, wantErr: io.ErrUnexpectedEOF},
+		{name: "内容过长", body: "hello!", size: 5, wantErr: errBodyTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := io.ReadAll(newExactReader(strings.NewReader(tt.body), tt.size))
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("读取失败: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, 期望 %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"io"
+	"time"
+)
+
+// 存储后端类型
+const (
+	BackendR2     = "r2"
+	BackendLocal  = "local"
+	BackendMemory = "memory"
+)
+
+// Storage 对象存储后端接口
+// R2Service 是默认实现，其他后端（MinIO、B2、S3、本地磁盘等）实现同样的方法即可接入
+type Storage interface {
+	// GenerateUploadURL 生成上传预签名 URL
+	// size 会被签入 URL，上传请求的 Content-Length 必须与之一致，防止绕过大小限制
+	GenerateUploadURL(key, contentType string, size int64, expiresIn time.Duration) (string, error)
+	// GenerateDownloadURL 生成下载预签名 URL（以原始文件名作为附件下载）
+	GenerateDownloadURL(key, filename string, expiresIn time.Duration) (string, error)
+	// GeneratePreviewURL 生成内联预览预签名 URL（Content-Disposition: inline，并以 contentType 作为响应类型）
+	GeneratePreviewURL(key, filename, contentType string, expiresIn time.Duration) (string, error)
+	// PutObject 由服务端直接写入对象（用于经 r2box 中转的上传），返回 ETag
+	PutObject(key, contentType string, body io.ReadSeeker, size int64) (string, error)
+
+	// InitiateMultipartUpload 初始化分片上传，返回 uploadID
+	InitiateMultipartUpload(key, contentType string) (string, error)
+	// GenerateMultipartUploadURL 生成分片上传预签名 URL（size 为该分片的字节数，同样签入 URL）
+	GenerateMultipartUploadURL(key, uploadID string, partNumber int32, size int64) (string, error)
+	// UploadPart 由服务端直接上传一个分片，返回 ETag
+	UploadPart(key, uploadID string, partNumber int32, body io.ReadSeeker, size int64) (string, error)
+	// ListParts 列出已上传的分片（按分片编号排序，内部自动分页）
+	ListParts(key, uploadID string) ([]Part, error)
+	// CompleteMultipartUpload 完成分片上传
+	CompleteMultipartUpload(key, uploadID string, parts []Part) error
+	// AbortMultipartUpload 终止分片上传
+	AbortMultipartUpload(key, uploadID string) error
+	// ListMultipartUploads 列出指定前缀下未完成的分片上传（内部自动分页）
+	ListMultipartUploads(prefix string) ([]MultipartUploadInfo, error)
+
+	// HeadObject 获取对象元数据，对象不存在时返回 ErrObjectNotFound
+	HeadObject(key string) (*ObjectInfo, error)
+	// GetObject 读取对象内容（流式读取，调用方负责关闭），对象不存在时返回 ErrObjectNotFound
+	GetObject(key string) (io.ReadCloser, error)
+	// ListObjects 列出指定前缀下的全部对象（内部自动分页）
+	ListObjects(prefix string) ([]ObjectInfo, error)
+	// DeleteObject 删除对象
+	DeleteObject(key string) error
+	// TestConnection 测试存储连接
+	TestConnection() error
+}
+
+// Part 分片信息
+type Part struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size,omitempty"`
+
+	// LastModified 分片的写入时间（ListParts 返回，用于判断上传是否仍有活动）
+	LastModified time.Time `json:"-"`
+}
+
+// ObjectInfo 对象信息
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// MultipartUploadInfo 未完成的分片上传信息
+type MultipartUploadInfo struct {
+	Key       string    `json:"key"`
+	UploadID  string    `json:"upload_id"`
+	Initiated time.Time `json:"initiated"`
+}
+
+// 确保各后端实现了 Storage 接口
+var (
+	_ Storage = (*R2Service)(nil)
+	_ Storage = (*LocalStorage)(nil)
+	_ Storage = (*MemoryStorage)(nil)
+)
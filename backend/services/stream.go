@@ -0,0 +1,173 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// ErrBodyTooLarge 上传内容超过大小限制
+var ErrBodyTooLarge = errors.New("上传内容超过大小限制")
+
+// maxMemoryPart 在内存中缓冲的最大分片大小，更大的分片先写入临时文件再上传，避免每个请求按分片大小占用内存
+const maxMemoryPart = MinPartSize
+
+// ReserveFunc 在写入数据前以累计字节数调用，返回错误时终止上传（用于长度未知时逐步预留配额）
+type ReserveFunc func(size int64) error
+
+// StreamUpload 将 body 经由服务端流式写入存储
+// 内容不足一个分片时直接 PutObject，否则按 partSize 逐个缓冲并上传分片，失败时终止分片上传
+// 不超过 maxMemoryPart 的分片缓冲在内存中，更大的分片缓冲在临时文件中
+// 最多读取 limit 字节，超出时返回 ErrBodyTooLarge；reserve 不为 nil 时每次写入前调用；返回实际写入的字节数
+func StreamUpload(storage Storage, key, contentType string, body io.Reader, partSize, limit int64, reserve ReserveFunc) (int64, error) {
+	reader := io.LimitReader(body, limit+1)
+
+	// 小文件只需 limit+1 字节的缓冲即可判断是否超限
+	if limit+1 < partSize {
+		partSize = limit + 1
+	}
+	spool, err := newPartSpool(partSize)
+	if err != nil {
+		return 0, err
+	}
+	defer spool.Close()
+
+	n, err := spool.Fill(reader)
+	if err != nil {
+		return 0, err
+	}
+	if n < partSize {
+		if n > limit {
+			return 0, ErrBodyTooLarge
+		}
+		if reserve != nil {
+			if err := reserve(n); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := storage.PutObject(key, contentType, spool.Reader(), n); err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+
+	uploadID, err := storage.InitiateMultipartUpload(key, contentType)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := streamParts(storage, key, uploadID, reader, spool, n, limit, reserve)
+	if err != nil {
+		if abortErr := storage.AbortMultipartUpload(key, uploadID); abortErr != nil {
+			log.Printf("[Stream] 终止分片上传失败: key=%s, %v", key, abortErr)
+		}
+		return 0, err
+	}
+	return size, nil
+}
+
+// streamParts 上传已读取的第一个分片及其后的全部分片并完成分片上传
+func streamParts(storage Storage, key, uploadID string, reader io.Reader, spool *partSpool, n, limit int64, reserve ReserveFunc) (int64, error) {
+	var parts []Part
+	var size int64
+
+	for partNumber := int32(1); n > 0; partNumber++ {
+		size += n
+		if size > limit {
+			return 0, ErrBodyTooLarge
+		}
+		if partNumber > MaxPartCount {
+			return 0, fmt.Errorf("分片数超过 %d 个的上限", MaxPartCount)
+		}
+		if reserve != nil {
+			if err := reserve(size); err != nil {
+				return 0, err
+			}
+		}
+
+		etag, err := storage.UploadPart(key, uploadID, partNumber, spool.Reader(), n)
+		if err != nil {
+			return 0, err
+		}
+		parts = append(parts, Part{PartNumber: partNumber, ETag: etag, Size: n})
+
+		if n, err = spool.Fill(reader); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := storage.CompleteMultipartUpload(key, uploadID, parts); err != nil {
+		return 0, err
+	}
+
+	log.Printf("[Stream] 分片上传完成: key=%s, size=%d, parts=%d", key, size, len(parts))
+	return size, nil
+}
+
+// partSpool 缓冲一个分片的数据，分片大小不超过 maxMemoryPart 时使用内存，否则使用临时文件
+type partSpool struct {
+	size int64
+	n    int64
+	buf  []byte
+	file *os.File
+}
+
+// newPartSpool 创建可容纳 size 字节的分片缓冲
+func newPartSpool(size int64) (*partSpool, error) {
+	if size <= maxMemoryPart {
+		return &partSpool{size: size, buf: make([]byte, size)}, nil
+	}
+	f, err := os.CreateTemp("", "r2box-stream-*.part")
+	if err != nil {
+		return nil, fmt.Errorf("创建分片缓冲文件失败: %w", err)
+	}
+	return &partSpool{size: size, file: f}, nil
+}
+
+// Fill 用 r 中接下来最多一个分片的数据替换缓冲内容，返回读取的字节数
+// r 已读完时返回的字节数小于分片大小
+func (s *partSpool) Fill(r io.Reader) (int64, error) {
+	if s.file == nil {
+		n, err := io.ReadFull(r, s.buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		s.n = int64(n)
+		return s.n, err
+	}
+
+	if err := s.file.Truncate(0); err != nil {
+		return 0, err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.CopyN(s.file, r, s.size)
+	if err == io.EOF {
+		err = nil
+	}
+	s.n = n
+	return n, err
+}
+
+// Reader 读取当前缓冲的分片数据
+func (s *partSpool) Reader() io.ReadSeeker {
+	if s.file == nil {
+		return bytes.NewReader(s.buf[:s.n])
+	}
+	return io.NewSectionReader(s.file, 0, s.n)
+}
+
+// Close 删除临时文件
+func (s *partSpool) Close() {
+	if s.file == nil {
+		return
+	}
+	s.file.Close()
+	if err := os.Remove(s.file.Name()); err != nil {
+		log.Printf("[Stream] 删除分片缓冲文件失败: %s, %v", s.file.Name(), err)
+	}
+}
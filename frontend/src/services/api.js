@@ -64,6 +64,10 @@ export default {
   },
 
   // 文件上传
+  getUploadOptions() {
+    return api.get('/upload/options')
+  },
+
   getUploadURL(data) {
     return api.post('/upload/presign', data)
   },
@@ -76,6 +80,10 @@ export default {
     return api.post('/upload/multipart/presign', data)
   },
 
+  getMultipartUploadURLs(data) {
+    return api.post('/upload/multipart/presign-batch', data)
+  },
+
   completeMultipartUpload(data) {
     return api.post('/upload/multipart/complete', data)
   },
@@ -93,10 +101,60 @@ export default {
     return api.delete(`/files/${fileId}`)
   },
 
+  pinFile(fileId) {
+    return api.post(`/files/${fileId}/pin`)
+  },
+
+  unpinFile(fileId) {
+    return api.delete(`/files/${fileId}/pin`)
+  },
+
+  setFilePassword(fileId, password) {
+    return api.put(`/files/${fileId}/password`, { password })
+  },
+
+  setShortCode(fileId, shortCode) {
+    return api.put(`/files/${fileId}/short-code`, { short_code: shortCode })
+  },
+
+  checkShortCode(shortCode) {
+    return api.get(`/short-codes/${encodeURIComponent(shortCode)}`)
+  },
+
+  // 文本片段
+  createPaste(data) {
+    return api.post('/pastes', data)
+  },
+
+  // 文件合集
+  getBundles() {
+    return api.get('/bundles')
+  },
+
+  createBundle(data) {
+    return api.post('/bundles', data)
+  },
+
+  addBundleFiles(bundleId, fileIds) {
+    return api.post(`/bundles/${bundleId}/files`, { file_ids: fileIds })
+  },
+
+  removeBundleFile(bundleId, fileId) {
+    return api.delete(`/bundles/${bundleId}/files/${fileId}`)
+  },
+
+  deleteBundle(bundleId) {
+    return api.delete(`/bundles/${bundleId}`)
+  },
+
   getDownloadURL(fileId) {
     return `/api/files/${fileId}/download`
   },
 
+  getArchiveURL(fileIds) {
+    return `/api/files/archive?ids=${fileIds.map(encodeURIComponent).join(',')}`
+  },
+
   // 存储统计
   getStats() {
     return api.get('/stats')
@@ -33,6 +33,15 @@ export const useFilesStore = defineStore('files', {
       } catch (error) {
         throw error
       }
+    },
+
+    async setPinned(fileId, pinned) {
+      if (pinned) {
+        await api.pinFile(fileId)
+      } else {
+        await api.unpinFile(fileId)
+      }
+      await this.fetchFiles(this.page)
     }
   }
 })